@@ -1,16 +1,26 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"log"
+	"os"
 
 	"github.com/pal-paul/git-copy/internal/gitcopy"
 )
 
 func main() {
-	// Initialize environment variables
-	if err := gitcopy.InitializeEnvironment(); err != nil {
+	command, args := gitcopy.SplitCommand(os.Args[1:])
+
+	// Resolve configuration from flags, environment variables and config file
+	if err := gitcopy.LoadEnvironment(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
 		log.Fatal(err)
 	}
 
-	gitcopy.RunApplication()
+	if err := gitcopy.Run(command, os.Stdout); err != nil {
+		log.Fatalf("ERROR: %v", err)
+	}
 }
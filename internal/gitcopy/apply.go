@@ -0,0 +1,293 @@
+package gitcopy
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pal-paul/go-libraries/pkg/git"
+)
+
+// ApplyResult describes what Apply changed in the destination repository.
+type ApplyResult struct {
+	Written     int  // number of files written
+	PullRequest int  // number of the created or updated pull request, 0 when there is none
+	Created     bool // whether the pull request was created by this run
+	AutoMerge   bool // whether auto-merge was enabled on the pull request
+}
+
+// Apply writes the changes of plan to the destination repository and opens a
+// pull request for them. In direct mode the changes are committed to the base
+// branch instead, provided its protection accepts the push.
+func Apply(plan *Plan) (*ApplyResult, error) {
+	if plan.Mode == ModeCheck {
+		return nil, fmt.Errorf("mode check does not write to the destination")
+	}
+	if len(plan.Conflicts) > 0 && plan.ConflictPolicy == ConflictFail {
+		return nil, fmt.Errorf("%d destination file(s) were modified since the last sync", len(plan.Conflicts))
+	}
+	if len(plan.Secrets) > 0 && plan.SecretScan == SecretScanBlock {
+		findings := make([]string, 0, len(plan.Secrets))
+		for _, finding := range plan.Secrets {
+			findings = append(findings, finding.String())
+		}
+		return nil, fmt.Errorf("%d possible secret(s) found in the files to copy: %s", len(plan.Secrets), strings.Join(findings, "; "))
+	}
+
+	var gitReviewers git.Reviewers
+	if envVar.Input.Reviewers != "" {
+		envVar.Input.Reviewers = strings.ReplaceAll(envVar.Input.Reviewers, " ", "")
+		gitReviewers.Users = append(gitReviewers.Users, strings.Split(envVar.Input.Reviewers, ",")...)
+	}
+	if envVar.Input.TeamReviewers != "" {
+		envVar.Input.TeamReviewers = strings.ReplaceAll(envVar.Input.TeamReviewers, " ", "")
+		gitReviewers.Teams = append(gitReviewers.Teams, strings.Split(envVar.Input.TeamReviewers, ",")...)
+	}
+
+	pullOptions, err := ParsePullOptions()
+	if err != nil {
+		return nil, err
+	}
+	templates, err := parseTemplates(plan)
+	if err != nil {
+		return nil, err
+	}
+	commits, err := newCommitFormatter(plan.Source)
+	if err != nil {
+		return nil, err
+	}
+
+	gitObj := newGitClient()
+	api := newApiClient(envVar.Input.Owner, envVar.Input.Repo)
+	writer, err := newCommitWriter(api, plan.Source)
+	if err != nil {
+		return nil, err
+	}
+	result := &ApplyResult{}
+
+	if plan.Mode == ModeDirect {
+		reasons, err := api.pushBlockers(plan.Branch)
+		if err != nil {
+			return nil, err
+		}
+		if len(reasons) > 0 {
+			return nil, fmt.Errorf("branch protection on %s rejects direct commits (%s), use mode pr instead", plan.Branch, strings.Join(reasons, ", "))
+		}
+	}
+
+	// Everything written by this run goes into a single commit
+	var written, staged []FileChange
+	var subjects, messages []string
+
+	if plan.File != nil {
+		file := plan.File
+		if file.Write() {
+			message := fmt.Sprintf("update file from source %s to destination %s", envVar.Input.FilePath, envVar.Input.DestinationFilePath)
+			if file.Action == ActionCreate {
+				message = fmt.Sprintf("%s file created", envVar.Input.DestinationFilePath)
+			}
+			subjects = append(subjects, message)
+			written = append(written, *file)
+		} else {
+			log.Printf("INFO: No changes written for %s", envVar.Input.FilePath)
+		}
+		if file.Action == ActionCreate {
+			messages = append(messages, fmt.Sprintf("file %s created at %s", envVar.Input.DestinationFilePath, time.Now().Format("2006-01-02 15:04:05")))
+		} else {
+			messages = append(messages, fmt.Sprintf("file %s updated to %s", envVar.Input.FilePath, envVar.Input.DestinationFilePath))
+		}
+	}
+
+	if envVar.Input.Directory != "" {
+		count := 0
+		for _, file := range plan.Directory {
+			if file.Write() {
+				written = append(written, file)
+				count++
+			}
+		}
+
+		if count > 0 {
+			subjects = append(subjects, fmt.Sprintf("updates files from source %s to destination %s", envVar.Input.Directory, envVar.Input.DestinationDirectory))
+			messages = append(messages, fmt.Sprintf("directory %s updated to %s", envVar.Input.Directory, envVar.Input.DestinationDirectory))
+			messages = append(messages, fmt.Sprintf("updated %d files in %s", count, envVar.Input.DestinationDirectory))
+		} else {
+			messages = append(messages, fmt.Sprintf("no files updated in %s", envVar.Input.DestinationDirectory))
+		}
+	}
+	staged = append(staged, written...)
+
+	if plan.lock != nil && len(written) > 0 {
+		for _, file := range plan.Files() {
+			if file.Action == ActionSkip {
+				continue
+			}
+			plan.lock.Files[file.Path] = LockEntry{
+				Sha:          file.lockSha(),
+				Source:       file.Source,
+				SourcePath:   plan.Source.RepoPath(file.Source),
+				SourceRepo:   plan.Source.Repo,
+				SourceCommit: plan.Source.Commit,
+			}
+		}
+		lockContent, err := plan.lock.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		staged = append(staged, FileChange{Path: envVar.Input.LockFile, Content: lockContent, Sha: plan.lockSha})
+	}
+
+	if len(written) > 0 {
+		message, err := render(templates.commit, newTemplateData(plan, written), strings.Join(subjects, "\n\n"))
+		if err != nil {
+			return nil, err
+		}
+		if err := uploadLFSObjects(plan, written); err != nil {
+			return nil, err
+		}
+		if _, err := writer.commit(plan, commits.format(message), staged); err != nil {
+			return nil, pushError(plan, err)
+		}
+		result.Written = len(written)
+	}
+
+	messages = append(messages, FormatMerges(plan.Merged, plan.MergeMarked, plan.MergeExcluded)...)
+	messages = append(messages, FormatConflicts(plan.ConflictPolicy, plan.Conflicts)...)
+	messages = append(messages, FormatExclusions(plan.Files())...)
+
+	changes := plan.Changes()
+	for _, file := range changes {
+		log.Printf("INFO: changes to %s:\n%s", file.Path, truncateDiff(fileDiff(file), maxFileDiffSize))
+	}
+
+	if plan.Mode == ModeDirect {
+		log.Printf("INFO: committed %d file(s) directly to %s", result.Written, plan.Branch)
+		return result, nil
+	}
+
+	var pull *PullRequest
+	if !plan.BranchExists {
+		if result.Written == 0 {
+			// The branch is only created together with the first commit
+			log.Printf("INFO: nothing to copy, pull request not created")
+			return result, nil
+		}
+		title, body, err := pullRequestText(plan, templates, changes, messages)
+		if err != nil {
+			return nil, err
+		}
+		pull, err = api.createPullRequest(
+			plan.BaseBranch,
+			plan.Branch,
+			title,
+			body,
+			pullOptions.Draft,
+		)
+		if err != nil {
+			return nil, err
+		}
+		result.Created = true
+		if pullOptions.CodeownersReviewers {
+			author, err := api.authenticatedUser()
+			if err != nil {
+				return nil, err
+			}
+			paths := make([]string, 0, len(changes))
+			for _, file := range changes {
+				paths = append(paths, filepath.ToSlash(file.Path))
+			}
+			users, teams, err := api.codeownersReviewers(plan.BaseBranch, paths, author)
+			if err != nil {
+				return nil, err
+			}
+			gitReviewers.Users = appendUnique(gitReviewers.Users, users...)
+			gitReviewers.Teams = appendUnique(gitReviewers.Teams, teams...)
+		}
+		if gitReviewers.Users != nil || gitReviewers.Teams != nil {
+			err = gitObj.AddReviewers(pull.Number, gitReviewers)
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		pull, err = api.findPullRequest(plan.Branch, plan.BaseBranch)
+		if err != nil {
+			return nil, err
+		}
+		if pull == nil {
+			return result, nil
+		}
+		if result.Written > 0 {
+			// The description shows the changes of the latest push
+			title, body, err := pullRequestText(plan, templates, changes, messages)
+			if err != nil {
+				return nil, err
+			}
+			if err := api.updatePullRequest(pull.Number, title, body); err != nil {
+				return nil, err
+			}
+		}
+	}
+	result.PullRequest = pull.Number
+	if err := api.decoratePullRequest(pull, pullOptions); err != nil {
+		return nil, err
+	}
+	if pullOptions.AutoMerge != "" {
+		if err := api.enableAutoMerge(pull, pullOptions.AutoMerge); err != nil {
+			log.Printf("WARNING: could not enable auto-merge on pull request #%d: %v", pull.Number, err)
+		} else {
+			result.AutoMerge = true
+			log.Printf("INFO: auto-merge (%s) enabled on pull request #%d", strings.ToLower(pullOptions.AutoMerge), pull.Number)
+		}
+	}
+	return result, nil
+}
+
+// pushError explains a failed commit in direct mode, where branch protection is the usual cause.
+func pushError(plan *Plan, err error) error {
+	if plan.Mode == ModeDirect {
+		return fmt.Errorf("direct commit to %s was rejected, check its branch protection: %w", plan.Branch, err)
+	}
+	return err
+}
+
+// pullRequestText returns the title and body of the pull request, rendered from
+// the templates when they are configured. The diffs are cut to keep the body
+// within GitHub's size limit.
+func pullRequestText(plan *Plan, templates *messageTemplates, changes []FileChange, messages []string) (string, string, error) {
+	title := envVar.Input.PullMessage
+	if title == "" {
+		title = fmt.Sprintf("copy file(s) at %s", time.Now().Format("2006-01-02 15:04:05"))
+	}
+	data := newTemplateData(plan, changes)
+	data.Description = envVar.Input.PullDescription
+	data.Summary = strings.Join(messages, "\n")
+	title, err := render(templates.title, data, title)
+	if err != nil {
+		return "", "", err
+	}
+	title = strings.TrimSpace(title)
+
+	if templates.body == nil {
+		if envVar.Input.PullDescription != "" {
+			messages = append([]string{envVar.Input.PullDescription}, messages...)
+		}
+		// Leave room for the headings and the note about omitted files
+		limit := maxPullBodySize - len(strings.Join(messages, "\n")) - 1024
+		messages = append(messages, FormatDiffs(changes, limit)...)
+		return title, strings.Join(messages, "\n"), nil
+	}
+
+	withoutDiffs, err := render(templates.body, data, "")
+	if err != nil {
+		return "", "", err
+	}
+	data.Diffs = strings.Join(FormatDiffs(changes, maxPullBodySize-len(withoutDiffs)-1024), "\n")
+	body, err := render(templates.body, data, "")
+	if err != nil {
+		return "", "", err
+	}
+	return title, body, nil
+}
@@ -0,0 +1,180 @@
+package gitcopy
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// newArchiveSource reads the files from a .tar.gz, .tar or .zip archive, given as a local
+// path or an http(s) URL, into memory. Nothing is extracted to disk.
+func newArchiveSource(location string, symlinks SymlinkPolicy) (*treeSource, error) {
+	var data []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		data, err = downloadArchive(location)
+	} else {
+		data, err = ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive %s: %w", location, err)
+	}
+	entries, err := extractArchive(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract archive %s: %w", location, err)
+	}
+	log.Printf("INFO: read %d file(s) from archive %s", len(entries), location)
+	return &treeSource{
+		symlinks: symlinks,
+		revision: SourceRevision{
+			Repo:    envVar.GitHub.Repo,
+			Commit:  envVar.GitHub.Commit,
+			Ref:     envVar.GitHub.Branch,
+			Archive: location,
+		},
+		entries: entries,
+	}, nil
+}
+
+// downloadArchive fetches an archive. The token is only sent to the GitHub API, which
+// serves workflow artifacts and repository archives, and not to any other host.
+func downloadArchive(location string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	if api, err := url.Parse(apiBaseUrl()); err == nil && req.URL.Host == api.Host {
+		req.Header.Set("Authorization", "token "+envVar.GitHub.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("ERROR: closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// extractArchive indexes the files of an archive, detecting its format from the content.
+func extractArchive(data []byte) (map[string]treeEntry, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return extractZip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return extractTar(reader)
+	case len(data) > 262 && string(data[257:262]) == "ustar":
+		return extractTar(bytes.NewReader(data))
+	default:
+		return nil, fmt.Errorf("unsupported format, expected .tar.gz, .tar or .zip")
+	}
+}
+
+// extractTar indexes the regular files and symbolic links of a tar stream.
+func extractTar(r io.Reader) (map[string]treeEntry, error) {
+	entries := make(map[string]treeEntry)
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, ok := archivePath(header.Name)
+		if !ok {
+			continue
+		}
+		switch {
+		case header.Typeflag == tar.TypeSymlink:
+			entries[name] = treeEntry{Mode: gitModeSymlink, Content: []byte(header.Linkname)}
+		case header.FileInfo().Mode().IsRegular():
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				return nil, err
+			}
+			entries[name] = treeEntry{Mode: archiveMode(os.FileMode(header.Mode)), Content: content}
+		}
+	}
+}
+
+// extractZip indexes the files and symbolic links of a zip archive.
+func extractZip(data []byte) (map[string]treeEntry, error) {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]treeEntry)
+	for _, file := range reader.File {
+		mode := file.Mode()
+		if mode.IsDir() {
+			continue
+		}
+		name, ok := archivePath(file.Name)
+		if !ok {
+			continue
+		}
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if mode&os.ModeSymlink != 0 {
+			entries[name] = treeEntry{Mode: gitModeSymlink, Content: content}
+			continue
+		}
+		entries[name] = treeEntry{Mode: archiveMode(mode), Content: content}
+	}
+	return entries, nil
+}
+
+// readZipFile returns the uncompressed content of a zip entry.
+func readZipFile(file *zip.File) ([]byte, error) {
+	reader, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			log.Printf("ERROR: closing %s: %v", file.Name, err)
+		}
+	}()
+	return io.ReadAll(reader)
+}
+
+// archivePath cleans the name of an archive entry. Entries that would lie outside the
+// archive root are reported and left out.
+func archivePath(name string) (string, bool) {
+	cleaned := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if path.IsAbs(cleaned) || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		log.Printf("WARNING: skipping archive entry %s outside the archive root", name)
+		return "", false
+	}
+	return strings.TrimPrefix(cleaned, "./"), cleaned != "."
+}
+
+// archiveMode maps the permissions recorded in an archive to the git file mode.
+func archiveMode(mode os.FileMode) string {
+	if mode.Perm()&0o111 != 0 {
+		return gitModeExecutable
+	}
+	return gitModeFile
+}
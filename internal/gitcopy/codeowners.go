@@ -0,0 +1,145 @@
+package gitcopy
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// codeownersPaths are the locations GitHub reads CODEOWNERS from, in order of precedence.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// codeownersRule is a single pattern of a CODEOWNERS file and its owners.
+type codeownersRule struct {
+	pattern *regexp.Regexp
+	owners  []string
+}
+
+// Codeowners holds the rules of a CODEOWNERS file in file order.
+type Codeowners struct {
+	rules []codeownersRule
+}
+
+// ParseCodeowners reads a CODEOWNERS file. Lines with an invalid pattern are
+// skipped, as GitHub does.
+func ParseCodeowners(data []byte) *Codeowners {
+	codeowners := &Codeowners{}
+	for number, line := range strings.Split(string(data), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		pattern, err := codeownersPattern(fields[0])
+		if err != nil {
+			log.Printf("WARNING: ignoring CODEOWNERS line %d: %v", number+1, err)
+			continue
+		}
+		codeowners.rules = append(codeowners.rules, codeownersRule{pattern: pattern, owners: fields[1:]})
+	}
+	return codeowners
+}
+
+// Owners returns the owners of path. The last matching rule wins, and a rule
+// without owners leaves the path unowned.
+func (c *Codeowners) Owners(path string) []string {
+	for i := len(c.rules) - 1; i >= 0; i-- {
+		if c.rules[i].pattern.MatchString(path) {
+			return c.rules[i].owners
+		}
+	}
+	return nil
+}
+
+// codeownersPattern compiles a CODEOWNERS pattern. Patterns follow the gitignore
+// rules, except that a wildcard in the last segment does not match nested files.
+func codeownersPattern(pattern string) (*regexp.Regexp, error) {
+	if strings.HasPrefix(pattern, "!") || strings.Contains(pattern, "[") {
+		return nil, fmt.Errorf("unsupported pattern %q", pattern)
+	}
+	anchored := strings.HasPrefix(pattern, "/") || strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	directory := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	var expr strings.Builder
+	if anchored {
+		expr.WriteString("^")
+	} else {
+		expr.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case pattern[i] == '*':
+			expr.WriteString("[^/]*")
+		case pattern[i] == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	last := pattern[strings.LastIndex(pattern, "/")+1:]
+	switch {
+	case directory:
+		expr.WriteString("/.*")
+	case !strings.Contains(last, "*"):
+		// A plain name also matches everything inside a directory of that name
+		expr.WriteString("(?:/.*)?")
+	}
+	expr.WriteString("$")
+	return regexp.Compile(expr.String())
+}
+
+// codeownersReviewers returns the users and teams owning paths according to the
+// CODEOWNERS file on ref. Teams are returned as slugs, email owners are left out
+// and exclude is removed from the users.
+func (c *apiClient) codeownersReviewers(ref string, paths []string, exclude string) ([]string, []string, error) {
+	var data []byte
+	for _, location := range codeownersPaths {
+		fileObj, err := c.getFile(ref, location)
+		if err != nil {
+			return nil, nil, err
+		}
+		if fileObj == nil {
+			continue
+		}
+		data, err = decodeContent(fileObj)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to decode %s: %w", location, err)
+		}
+		break
+	}
+	if data == nil {
+		log.Printf("INFO: no CODEOWNERS file found on %s", ref)
+		return nil, nil, nil
+	}
+
+	codeowners := ParseCodeowners(data)
+	var users, teams []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		for _, owner := range codeowners.Owners(path) {
+			if seen[owner] || !strings.HasPrefix(owner, "@") {
+				continue
+			}
+			seen[owner] = true
+			name := strings.TrimPrefix(owner, "@")
+			if _, team, ok := strings.Cut(name, "/"); ok {
+				teams = append(teams, team)
+			} else if !strings.EqualFold(name, exclude) {
+				users = append(users, name)
+			}
+		}
+	}
+	return users, teams, nil
+}
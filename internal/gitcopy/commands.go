@@ -0,0 +1,190 @@
+package gitcopy
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Commands of the git-copy binary. Apply is the default and matches the
+// behavior of the GitHub Action.
+const (
+	CommandApply  = "apply"
+	CommandPlan   = "plan"
+	CommandDiff   = "diff"
+	CommandStatus = "status"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// SplitCommand separates a leading subcommand from the remaining arguments.
+// Without one the command is apply.
+func SplitCommand(args []string) (string, []string) {
+	if len(args) > 0 {
+		switch args[0] {
+		case CommandApply, CommandPlan, CommandDiff, CommandStatus:
+			return args[0], args[1:]
+		}
+	}
+	return CommandApply, args
+}
+
+// Run executes command against the loaded environment and writes its report to out.
+func Run(command string, out io.Writer) error {
+	plan, err := BuildPlan()
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case CommandPlan:
+		WritePlan(out, plan)
+	case CommandDiff:
+		WriteDiff(out, plan)
+	case CommandStatus:
+		var pull *PullRequest
+		if plan.Mode == ModePullRequest {
+			api := newApiClient(envVar.Input.Owner, envVar.Input.Repo)
+			pull, err = api.findPullRequest(plan.Branch, plan.BaseBranch)
+			if err != nil {
+				return err
+			}
+		}
+		WriteStatus(out, plan, pull)
+	case CommandApply:
+		if plan.Mode == ModeCheck {
+			return runCheck(out, plan)
+		}
+		result, err := Apply(plan)
+		if err != nil {
+			return err
+		}
+		_, _ = fmt.Fprintf(out, "%d file(s) written to %s/%s on %s\n", result.Written, envVar.Input.Owner, envVar.Input.Repo, plan.Branch)
+		if result.Created {
+			_, _ = fmt.Fprintf(out, "pull request #%d created\n", result.PullRequest)
+		} else if result.PullRequest != 0 {
+			_, _ = fmt.Fprintf(out, "pull request #%d updated\n", result.PullRequest)
+		}
+		if result.AutoMerge {
+			_, _ = fmt.Fprintf(out, "auto-merge enabled on pull request #%d\n", result.PullRequest)
+		}
+		for _, file := range plan.Files() {
+			if file.Excluded != "" {
+				_, _ = fmt.Fprintf(out, "excluded %s: %s\n", file.Path, file.Excluded)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown command %q", command)
+	}
+	return nil
+}
+
+// runCheck reports the drift between source and destination and returns ErrDrift when there is any.
+func runCheck(out io.Writer, plan *Plan) error {
+	result, err := Check(plan)
+	if err != nil {
+		return err
+	}
+	if len(result.Drifted) == 0 {
+		_, _ = fmt.Fprintf(out, "in sync: %s matches the source\n", plan.CompareRef)
+	} else {
+		_, _ = fmt.Fprintf(out, "out of sync: %d file(s) differ on %s\n", len(result.Drifted), plan.CompareRef)
+		for _, file := range result.Drifted {
+			_, _ = fmt.Fprintf(out, "  %-9s %s\n", file.Action, file.Path)
+		}
+	}
+	if result.IssueAction != "" {
+		_, _ = fmt.Fprintf(out, "tracking issue #%d %s\n", result.Issue, result.IssueAction)
+	}
+	if len(result.Drifted) > 0 {
+		return fmt.Errorf("%w: %d file(s) differ", ErrDrift, len(result.Drifted))
+	}
+	return nil
+}
+
+// WritePlan writes one line per file with the action a run would take, followed by a summary.
+func WritePlan(out io.Writer, plan *Plan) {
+	if plan.Source.Remote || plan.Source.Archive != "" {
+		_, _ = fmt.Fprintf(out, "source %s\n", plan.Source)
+	}
+	_, _ = fmt.Fprintf(out, "destination %s/%s, compared against %s\n", envVar.Input.Owner, envVar.Input.Repo, plan.CompareRef)
+	counts := make(map[ChangeAction]int)
+	for _, file := range plan.Files() {
+		counts[file.Action]++
+		note := ""
+		if file.ModeChanged() {
+			note = fmt.Sprintf(" (mode %s -> %s)", file.PreviousMode, file.GitMode())
+		}
+		if file.lfs != nil {
+			note += " (Git LFS)"
+		}
+		if file.Excluded != "" {
+			note += " (excluded: " + file.Excluded + ")"
+		}
+		_, _ = fmt.Fprintf(out, "  %-9s %s <- %s%s\n", file.Action, file.Path, file.Source, note)
+	}
+	for _, line := range FormatMerges(plan.Merged, plan.MergeMarked, plan.MergeExcluded) {
+		_, _ = fmt.Fprintln(out, line)
+	}
+	for _, line := range FormatConflicts(plan.ConflictPolicy, plan.Conflicts) {
+		_, _ = fmt.Fprintln(out, line)
+	}
+	for _, line := range FormatSecrets(plan.SecretScan, plan.Secrets) {
+		_, _ = fmt.Fprintln(out, line)
+	}
+	_, _ = fmt.Fprintf(out, "%d to create, %d to update, %d unchanged, %d skipped\n",
+		counts[ActionCreate], counts[ActionUpdate], counts[ActionUnchanged], counts[ActionSkip])
+}
+
+// WriteDiff writes a unified diff for every file a run would write.
+func WriteDiff(out io.Writer, plan *Plan) {
+	for _, file := range plan.Changes() {
+		_, _ = io.WriteString(out, fileDiff(file))
+	}
+}
+
+// fileDiff returns the unified diff of a single change against the destination.
+func fileDiff(file FileChange) string {
+	oldName := "a/" + file.Path
+	header := ""
+	if file.Action == ActionCreate {
+		oldName = "/dev/null"
+		if file.GitMode() != gitModeFile {
+			header = fmt.Sprintf("new file mode %s\n", file.GitMode())
+		}
+	} else if file.ModeChanged() {
+		header = fmt.Sprintf("old mode %s\nnew mode %s\n", file.PreviousMode, file.GitMode())
+	}
+	return header + UnifiedDiff(oldName, "b/"+file.Path, file.Previous, file.Content, diffContext)
+}
+
+// WriteStatus writes whether the destination is in sync and which pull request is open for the copy branch.
+func WriteStatus(out io.Writer, plan *Plan, pull *PullRequest) {
+	if plan.InSync() {
+		_, _ = fmt.Fprintf(out, "in sync: %s matches the source\n", plan.CompareRef)
+	} else {
+		var pending []string
+		for _, file := range plan.Files() {
+			if file.OutOfSync() {
+				pending = append(pending, file.Path)
+			}
+		}
+		_, _ = fmt.Fprintf(out, "out of sync: %d file(s) differ on %s\n", len(pending), plan.CompareRef)
+		for _, path := range pending {
+			_, _ = fmt.Fprintf(out, "  %s\n", path)
+		}
+	}
+	if plan.Mode == ModeDirect {
+		_, _ = fmt.Fprintf(out, "changes are committed directly to %s\n", plan.Branch)
+	} else if plan.Mode == ModeCheck {
+		_, _ = fmt.Fprintf(out, "check mode, nothing is written to %s\n", plan.Branch)
+	} else if pull != nil {
+		_, _ = fmt.Fprintf(out, "open pull request #%d from %s: %s\n", pull.Number, plan.Branch, pull.HtmlUrl)
+	} else {
+		_, _ = fmt.Fprintf(out, "no open pull request from %s into %s\n", plan.Branch, plan.BaseBranch)
+	}
+	if len(plan.Conflicts) > 0 {
+		_, _ = fmt.Fprintln(out, strings.Join(FormatConflicts(plan.ConflictPolicy, plan.Conflicts), "\n"))
+	}
+}
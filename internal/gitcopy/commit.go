@@ -0,0 +1,119 @@
+package gitcopy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+var (
+	commitTypePattern  = regexp.MustCompile(`^[A-Za-z]+$`)
+	commitScopePattern = regexp.MustCompile(`^[^()\r\n]+$`)
+)
+
+// commitFormatter turns the messages of the sync commits into Conventional
+// Commits and appends trailers recording where the content came from.
+type commitFormatter struct {
+	commitType string
+	scope      string
+	trailers   []string
+}
+
+// newCommitFormatter reads the commit_type, commit_scope, commit_signoff and
+// commit_co_author inputs. The author of the source commit is looked up only
+// when a trailer needs it.
+func newCommitFormatter(source SourceRevision) (*commitFormatter, error) {
+	commitType := strings.TrimSpace(envVar.Input.CommitType)
+	scope := strings.TrimSpace(envVar.Input.CommitScope)
+	if commitType != "" && !commitTypePattern.MatchString(commitType) {
+		return nil, fmt.Errorf("invalid commit_type %q, expected a single word such as chore or docs", commitType)
+	}
+	if scope != "" && !commitScopePattern.MatchString(scope) {
+		return nil, fmt.Errorf("invalid commit_scope %q", scope)
+	}
+	if scope != "" && commitType == "" {
+		return nil, fmt.Errorf("commit_scope requires commit_type")
+	}
+	signOff, err := parseBool("commit_signoff", envVar.Input.CommitSignoff)
+	if err != nil {
+		return nil, err
+	}
+	coAuthor, err := parseBool("commit_co_author", envVar.Input.CommitCoAuthor)
+	if err != nil {
+		return nil, err
+	}
+
+	var trailers []string
+	if source.Repo != "" {
+		trailers = append(trailers, "Source-Repo: "+source.Repo)
+	}
+	if source.Commit != "" {
+		trailers = append(trailers, "Source-Commit: "+source.Commit)
+	}
+	if run := runUrl(); run != "" {
+		trailers = append(trailers, "Source-Run: "+run)
+	}
+	if signOff || coAuthor {
+		author, err := sourceCommitAuthor(source)
+		if err != nil {
+			log.Printf("WARNING: could not look up the source commit author: %v", err)
+		} else if author != nil {
+			if signOff {
+				trailers = append(trailers, "Signed-off-by: "+author.String())
+			}
+			if coAuthor {
+				trailers = append(trailers, "Co-authored-by: "+author.String())
+			}
+		}
+	}
+	return &commitFormatter{commitType: commitType, scope: scope, trailers: trailers}, nil
+}
+
+// format prefixes the subject of message with the commit type and scope and appends the trailers.
+func (f *commitFormatter) format(message string) string {
+	return FormatCommitMessage(message, f.commitType, f.scope, f.trailers)
+}
+
+// FormatCommitMessage returns message with its first line turned into a
+// Conventional Commits subject when commitType is set, followed by the trailers.
+func FormatCommitMessage(message string, commitType string, scope string, trailers []string) string {
+	message = strings.TrimRight(message, "\n")
+	if commitType != "" {
+		prefix := commitType
+		if scope != "" {
+			prefix += "(" + scope + ")"
+		}
+		message = prefix + ": " + message
+	}
+	if len(trailers) == 0 {
+		return message
+	}
+	return message + "\n\n" + strings.Join(trailers, "\n")
+}
+
+// sourceCommitAuthor returns the author of the source commit, or nil when the commit is unknown.
+func sourceCommitAuthor(source SourceRevision) (*commitIdentity, error) {
+	owner, repo, ok := strings.Cut(source.Repo, "/")
+	if !ok || source.Commit == "" {
+		return nil, nil
+	}
+	var commit struct {
+		Commit struct {
+			Author commitIdentity `json:"author"`
+		} `json:"commit"`
+	}
+	status, err := newApiClient(owner, repo).do(http.MethodGet, "commits/"+source.Commit, nil, nil, &commit)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to get commit %s of %s: %d", shortSha(source.Commit), source.Repo, status)
+	}
+	author := commit.Commit.Author
+	if author.Name == "" || author.Email == "" {
+		return nil, nil
+	}
+	return &author, nil
+}
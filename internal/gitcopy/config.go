@@ -0,0 +1,176 @@
+package gitcopy
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// configEnvVar names the environment variable pointing at a config file when --config is not given.
+const configEnvVar = "GIT_COPY_CONFIG"
+
+// setting is a single configurable field of the Environment.
+type setting struct {
+	field    reflect.Value
+	envKey   string
+	flagName string
+	help     string
+	def      string
+	required bool
+}
+
+// settings lists every field of env that carries an env tag. The flag name comes
+// from the flag tag and otherwise mirrors the INPUT_* variable, so INPUT_FILE_PATH
+// becomes --file-path.
+func settings(env *Environment) []setting {
+	var result []setting
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i))
+				continue
+			}
+			tag := field.Tag.Get("env")
+			if tag == "" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			s := setting{
+				field:    v.Field(i),
+				envKey:   parts[0],
+				flagName: field.Tag.Get("flag"),
+				help:     field.Tag.Get("help"),
+			}
+			for _, option := range parts[1:] {
+				key, value, _ := strings.Cut(option, "=")
+				switch key {
+				case "default":
+					s.def = value
+				case "required":
+					s.required = value == "true"
+				}
+			}
+			if s.flagName == "" {
+				s.flagName = strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(s.envKey, "INPUT_")), "_", "-")
+			}
+			result = append(result, s)
+		}
+	}
+	walk(reflect.ValueOf(env).Elem())
+	return result
+}
+
+// LoadEnvironment resolves the configuration from command line flags, environment
+// variables and a JSON config file, in that order of precedence, before falling
+// back to the defaults. It returns flag.ErrHelp when --help was requested.
+func LoadEnvironment(args []string) error {
+	var loaded Environment
+	fields := settings(&loaded)
+
+	fs := flag.NewFlagSet("git-copy", flag.ContinueOnError)
+	configPath := fs.String("config", os.Getenv(configEnvVar), "JSON config file with flag names as keys (env "+configEnvVar+")")
+	values := make(map[string]*string, len(fields))
+	for _, s := range fields {
+		usage := fmt.Sprintf("%s (env %s)", s.help, s.envKey)
+		values[s.flagName] = fs.String(s.flagName, s.def, usage)
+	}
+	fs.Usage = func() {
+		out := fs.Output()
+		_, _ = fmt.Fprintln(out, "usage: git-copy [command] [flags]")
+		_, _ = fmt.Fprintln(out, "")
+		_, _ = fmt.Fprintln(out, "Copies files to another GitHub repository and opens a pull request.")
+		_, _ = fmt.Fprintln(out, "Every flag falls back to its environment variable, then to the config file.")
+		_, _ = fmt.Fprintln(out, "")
+		_, _ = fmt.Fprintln(out, "commands:")
+		_, _ = fmt.Fprintln(out, "  apply   copy the files and open a pull request (default)")
+		_, _ = fmt.Fprintln(out, "  plan    list the files that would be created or updated")
+		_, _ = fmt.Fprintln(out, "  diff    show unified diffs against the destination branch")
+		_, _ = fmt.Fprintln(out, "  status  report whether the destination is in sync and if a pull request is open")
+		_, _ = fmt.Fprintln(out, "")
+		_, _ = fmt.Fprintln(out, "flags:")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	config := map[string]string{}
+	if *configPath != "" {
+		var err error
+		config, err = readConfigFile(*configPath, values)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, s := range fields {
+		value, ok := *values[s.flagName], explicit[s.flagName]
+		if !ok {
+			value, ok = os.LookupEnv(s.envKey)
+			ok = ok && value != ""
+		}
+		if !ok {
+			value, ok = config[s.flagName]
+		}
+		if !ok {
+			value = s.def
+		}
+		if value == "" && s.required {
+			return fmt.Errorf("missing required value: --%s or %s", s.flagName, s.envKey)
+		}
+		s.field.SetString(value)
+	}
+
+	envVar = loaded
+	return nil
+}
+
+// readConfigFile reads a flat JSON object of settings. Keys are flag names;
+// the underscore spelling used by the action inputs is accepted as well. Keys
+// that name no flag are rejected rather than ignored, as they are most likely typos.
+func readConfigFile(path string, flags map[string]*string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	config := make(map[string]string, len(raw))
+	for key, value := range raw {
+		name := strings.ReplaceAll(strings.ToLower(key), "_", "-")
+		if _, ok := flags[name]; !ok {
+			return nil, fmt.Errorf("unknown key %q in config file %s", key, path)
+		}
+		key = name
+		switch v := value.(type) {
+		case string:
+			config[key] = v
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			config[key] = strings.Join(items, ",")
+		case nil:
+		default:
+			config[key] = fmt.Sprint(v)
+		}
+	}
+	return config, nil
+}
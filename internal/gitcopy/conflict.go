@@ -0,0 +1,97 @@
+package gitcopy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ConflictPolicy decides what happens to a destination file that was changed
+// since the last sync.
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite replaces the destination file with the source content.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictSkip leaves the destination file untouched.
+	ConflictSkip ConflictPolicy = "skip"
+	// ConflictFail aborts the run before anything is written.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictAnnotate overwrites the file and flags it prominently in the pull request.
+	ConflictAnnotate ConflictPolicy = "annotate-pr"
+)
+
+// ParseConflictPolicy validates an on_conflict input. An empty value selects
+// ConflictOverwrite, which matches the behavior before conflicts were detected.
+func ParseConflictPolicy(value string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return ConflictOverwrite, nil
+	case ConflictOverwrite, ConflictSkip, ConflictFail, ConflictAnnotate:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid on_conflict %q: expected overwrite, skip, fail or annotate-pr", value)
+	}
+}
+
+// Conflict is a destination file whose blob differs from the one recorded in
+// the lockfile at the last sync.
+type Conflict struct {
+	Path          string
+	Source        string
+	LastSyncedSha string
+	CurrentSha    string
+}
+
+// DetectConflict reports whether the destination file at path was modified
+// since the last sync. Files without a lockfile entry have no baseline and are
+// never reported.
+func DetectConflict(lock *Lockfile, path string, currentSha string) *Conflict {
+	if lock == nil || currentSha == "" {
+		return nil
+	}
+	entry, ok := lock.Files[path]
+	if !ok || entry.Sha == "" || entry.Sha == currentSha {
+		return nil
+	}
+	return &Conflict{
+		Path:          path,
+		Source:        entry.Source,
+		LastSyncedSha: entry.Sha,
+		CurrentSha:    currentSha,
+	}
+}
+
+// FormatConflicts renders the conflicts for the pull request description.
+func FormatConflicts(policy ConflictPolicy, conflicts []Conflict) []string {
+	if len(conflicts) == 0 {
+		return nil
+	}
+	var lines []string
+	switch policy {
+	case ConflictSkip:
+		lines = append(lines, "Destination files modified since the last sync were left unchanged:")
+	case ConflictAnnotate:
+		lines = append(lines,
+			"> [!WARNING]",
+			"> The following destination files were modified since the last sync.",
+			"> This pull request overwrites those changes, review them before merging.",
+		)
+	default:
+		lines = append(lines, "Destination files modified since the last sync were overwritten:")
+	}
+	for _, conflict := range conflicts {
+		line := fmt.Sprintf("- `%s` (last synced %s, now %s)", conflict.Path, shortSha(conflict.LastSyncedSha), shortSha(conflict.CurrentSha))
+		if policy == ConflictAnnotate {
+			line = "> " + line
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
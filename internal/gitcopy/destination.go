@@ -0,0 +1,91 @@
+package gitcopy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DestinationPath normalizes a path in the destination repository to the slash
+// separated form git uses. Backslashes, as produced on Windows runners, become
+// slashes, and absolute paths or paths with a .. segment are rejected so nothing
+// can be written outside the intended subtree. The repository root is ".".
+func DestinationPath(p string) (string, error) {
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	if strings.HasPrefix(slashed, "/") || hasVolumeName(slashed) {
+		return "", fmt.Errorf("destination path %q must be relative to the repository root", p)
+	}
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("destination path %q must not contain ..", p)
+		}
+	}
+	return path.Clean(slashed), nil
+}
+
+// hasVolumeName reports whether p starts with a Windows drive letter such as C:.
+func hasVolumeName(p string) bool {
+	return len(p) >= 2 && p[1] == ':' && (p[0] >= 'a' && p[0] <= 'z' || p[0] >= 'A' && p[0] <= 'Z')
+}
+
+// destinationFilePath normalizes the destination path of a file, which cannot be the repository root.
+func destinationFilePath(p string) (string, error) {
+	cleaned, err := DestinationPath(p)
+	if err != nil {
+		return "", err
+	}
+	if cleaned == "." {
+		return "", fmt.Errorf("destination path %q does not name a file", p)
+	}
+	return cleaned, nil
+}
+
+// PathAllowlist holds the allowed_destination_paths patterns.
+type PathAllowlist struct {
+	patterns []*regexp.Regexp
+}
+
+// ParsePathAllowlist reads a comma or newline separated list of patterns, which
+// follow the CODEOWNERS syntax but are always anchored at the repository root: docs/
+// allows everything below the top-level docs directory, *.md Markdown files at the
+// root and **/*.md Markdown files anywhere. An empty list allows every path.
+func ParsePathAllowlist(value string) (*PathAllowlist, error) {
+	allowlist := &PathAllowlist{}
+	for _, line := range strings.Split(value, "\n") {
+		for _, item := range splitList(line) {
+			item = strings.ReplaceAll(item, `\`, "/")
+			if !strings.HasPrefix(item, "!") {
+				// Negations are left as they are for codeownersPattern to reject
+				item = "/" + strings.TrimPrefix(item, "/")
+			}
+			pattern, err := codeownersPattern(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowed_destination_paths: %w", err)
+			}
+			allowlist.patterns = append(allowlist.patterns, pattern)
+		}
+	}
+	return allowlist, nil
+}
+
+// Allows reports whether files may be written to p, a normalized destination path.
+func (a *PathAllowlist) Allows(p string) bool {
+	if len(a.patterns) == 0 {
+		return true
+	}
+	for _, pattern := range a.patterns {
+		if pattern.MatchString(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns an error for p when it is outside the allowlist.
+func (a *PathAllowlist) check(p string) error {
+	if !a.Allows(p) {
+		return fmt.Errorf("destination path %s is not in allowed_destination_paths", p)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package gitcopy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// splitLines splits content into lines, keeping the line terminators so the
+// content can be reassembled byte for byte.
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(content, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines computes a longest common subsequence of a and b with the linear
+// space variant of Myers' algorithm. The result maps every index of a to its
+// matching index in b, or -1 when the line has no counterpart.
+func matchLines(a []string, b []string) []int {
+	matches := make([]int, len(a))
+	for i := range matches {
+		matches[i] = -1
+	}
+	matchRange(a, b, 0, 0, matches)
+	return matches
+}
+
+// matchRange matches a and b, which start at aOffset and bOffset of the full
+// inputs, by splitting them around the middle snake of their edit path.
+func matchRange(a []string, b []string, aOffset int, bOffset int, matches []int) {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		matches[aOffset] = bOffset
+		a, b = a[1:], b[1:]
+		aOffset++
+		bOffset++
+	}
+	for len(a) > 0 && len(b) > 0 && a[len(a)-1] == b[len(b)-1] {
+		matches[aOffset+len(a)-1] = bOffset + len(b) - 1
+		a, b = a[:len(a)-1], b[:len(b)-1]
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return
+	}
+	x, y, u, v := middleSnake(a, b)
+	for i := 0; i < u-x; i++ {
+		matches[aOffset+x+i] = bOffset + y + i
+	}
+	matchRange(a[:x], b[:y], aOffset, bOffset, matches)
+	matchRange(a[u:], b[v:], aOffset+u, bOffset+v, matches)
+}
+
+// middleSnake runs Myers' search from both ends of a and b at once and returns
+// the snake, from (x, y) to (u, v), where the two searches meet. The snake lies
+// on a shortest edit path and splits its edits in half. Only the furthest point
+// of every diagonal is kept, so memory is linear in the input.
+func middleSnake(a []string, b []string) (int, int, int, int) {
+	n, m := len(a), len(b)
+	delta := n - m
+	odd := delta%2 != 0
+	max := (n + m + 1) / 2
+	offset := max + 1
+	// forward[k] is the furthest x on diagonal x-y=k from the start, backward[k]
+	// the furthest on diagonal k counted from the end of both inputs.
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+	for d := 0; d <= max; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			if back := delta - k; odd && back >= -(d-1) && back <= d-1 && x+backward[offset+back] >= n {
+				return startX, startY, x, y
+			}
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			startX, startY := x, y
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			if ahead := delta - k; !odd && ahead >= -d && ahead <= d && x+forward[offset+ahead] >= n {
+				return n - x, m - y, n - startX, m - startY
+			}
+		}
+	}
+	// Not reached: the searches meet by the time d covers half of the edits.
+	return 0, 0, 0, 0
+}
+
+// diffOp is one line of an edit script: ' ' keeps, '-' deletes and '+' inserts a line.
+type diffOp struct {
+	kind byte
+	line string
+	a    int // index in the old lines, the insertion point for '+'
+	b    int // index in the new lines, the deletion point for '-'
+}
+
+// editScript turns the matched lines of a and b into a sequence of edits.
+func editScript(a []string, b []string) []diffOp {
+	matches := matchLines(a, b)
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && matches[i] == j:
+			ops = append(ops, diffOp{kind: ' ', line: a[i], a: i, b: j})
+			i++
+			j++
+		case i < len(a) && matches[i] < 0:
+			ops = append(ops, diffOp{kind: '-', line: a[i], a: i, b: j})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', line: b[j], a: i, b: j})
+			j++
+		}
+	}
+	return ops
+}
+
+// UnifiedDiff returns the changes from oldContent to newContent in unified
+// diff format with the given number of context lines. The result is empty when
+// both are equal.
+func UnifiedDiff(oldName string, newName string, oldContent []byte, newContent []byte, context int) string {
+	if string(oldContent) == string(newContent) {
+		return ""
+	}
+	if IsBinary(oldContent) || IsBinary(newContent) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", oldName, newName)
+	}
+	if len(oldContent)+len(newContent) > maxDiffInputSize {
+		return fmt.Sprintf("Files %s and %s differ, diff too large to show\n", oldName, newName)
+	}
+
+	ops := editScript(splitLines(string(oldContent)), splitLines(string(newContent)))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(ops); {
+		// Find the next change and extend the hunk while changes are close together.
+		first := start
+		for first < len(ops) && ops[first].kind == ' ' {
+			first++
+		}
+		if first == len(ops) {
+			break
+		}
+		last := first
+		for next := first; next < len(ops); next++ {
+			if ops[next].kind == ' ' {
+				continue
+			}
+			if next-last-1 > 2*context {
+				break
+			}
+			last = next
+		}
+		from := first - context
+		if from < start {
+			from = start
+		}
+		to := last + context + 1
+		if to > len(ops) {
+			to = len(ops)
+		}
+		writeHunk(&out, ops[from:to])
+		start = to
+	}
+	return out.String()
+}
+
+// writeHunk writes a single hunk header followed by its lines.
+func writeHunk(out *strings.Builder, ops []diffOp) {
+	oldStart, newStart := ops[0].a+1, ops[0].b+1
+	oldCount, newCount := 0, 0
+	for _, op := range ops {
+		if op.kind != '+' {
+			oldCount++
+		}
+		if op.kind != '-' {
+			newCount++
+		}
+	}
+	if oldCount == 0 {
+		oldStart--
+	}
+	if newCount == 0 {
+		newStart--
+	}
+	fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, op := range ops {
+		out.WriteByte(op.kind)
+		out.WriteString(op.line)
+		if !strings.HasSuffix(op.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// Limits that keep the pull request body under the 65536 characters GitHub accepts.
+const (
+	maxPullBodySize = 65536
+	maxFileDiffSize = 16384
+)
+
+// maxDiffInputSize is the combined size of the old and new content above which no diff
+// is computed: the result would be truncated to maxFileDiffSize anyway.
+const maxDiffInputSize = 1 << 20
+
+// truncateDiff cuts diff down to limit bytes at a line boundary and notes how
+// many lines were dropped.
+func truncateDiff(diff string, limit int) string {
+	if len(diff) <= limit {
+		return diff
+	}
+	kept := diff[:limit]
+	if i := strings.LastIndexByte(kept, '\n'); i >= 0 {
+		kept = kept[:i+1]
+	} else {
+		kept = strings.ToValidUTF8(kept, "") + "\n"
+	}
+	dropped := strings.Count(diff[len(kept):], "\n")
+	return fmt.Sprintf("%s... %d more line(s) not shown\n", kept, dropped)
+}
+
+// diffFence returns a code fence longer than any run of backticks in content.
+func diffFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			if run > longest {
+				longest = run
+			}
+		} else {
+			run = 0
+		}
+	}
+	if longest < 3 {
+		return "```"
+	}
+	return strings.Repeat("`", longest+1)
+}
+
+// FormatDiffs renders the diff of every change as a collapsible section for
+// the pull request body. Each diff is truncated to a per file limit and once
+// the sections would take the result past limit bytes the rest is only counted.
+func FormatDiffs(changes []FileChange, limit int) []string {
+	var sections []string
+	omitted := 0
+	size := 0
+	for _, file := range changes {
+		diff := fileDiff(file)
+		if diff == "" {
+			continue
+		}
+		diff = truncateDiff(diff, maxFileDiffSize)
+		fence := diffFence(diff)
+		section := fmt.Sprintf("<details>\n<summary>%s (%s)</summary>\n\n%sdiff\n%s%s\n\n</details>",
+			file.Path, file.Action, fence, diff, fence)
+		if omitted > 0 || size+len(section)+1 > limit {
+			omitted++
+			continue
+		}
+		sections = append(sections, section)
+		size += len(section) + 1
+	}
+	if omitted > 0 {
+		sections = append(sections, fmt.Sprintf("%d more changed file(s) not shown to keep the description within GitHub's size limit", omitted))
+	}
+	return sections
+}
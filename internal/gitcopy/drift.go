@@ -0,0 +1,224 @@
+package gitcopy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrDrift is returned by the check mode when the destination differs from the source.
+var ErrDrift = errors.New("destination is out of sync with the source")
+
+// issuesPerPage is the page size used to look for the tracking issue.
+const issuesPerPage = 100
+
+// maxDriftIssueRows is the number of drifted files listed in the tracking issue;
+// the rest are only counted so the body stays within GitHub's size limit.
+const maxDriftIssueRows = 200
+
+// CheckResult describes what a run in check mode found.
+type CheckResult struct {
+	Drifted     []FileChange // files that differ from the source
+	Issue       int          // number of the tracking issue, 0 when there is none
+	IssueAction string       // created, updated or closed, empty when the issue was left alone
+}
+
+// Issue is the part of an issue git-copy works with.
+type Issue struct {
+	Number      int            `json:"number"`
+	Title       string         `json:"title"`
+	Body        string         `json:"body"`
+	HtmlUrl     string         `json:"html_url"`
+	PullRequest map[string]any `json:"pull_request"` // set when the issue is a pull request
+}
+
+// Check compares the destination with the source without writing any file. With
+// drift_issue set, a single tracking issue in the destination is created or updated
+// with a summary of the drift, and closed once the destination is back in sync.
+func Check(plan *Plan) (*CheckResult, error) {
+	tracking, err := parseBool("drift_issue", envVar.Input.DriftIssue)
+	if err != nil {
+		return nil, err
+	}
+	result := &CheckResult{}
+	for _, file := range plan.Files() {
+		if file.OutOfSync() {
+			result.Drifted = append(result.Drifted, file)
+		}
+	}
+	if !tracking {
+		return result, nil
+	}
+
+	api := newApiClient(envVar.Input.Owner, envVar.Input.Repo)
+	marker := driftMarker(plan)
+	issue, err := api.findIssue(marker)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(result.Drifted) == 0 && issue != nil:
+		comment := fmt.Sprintf("The destination is back in sync with %s.", plan.Source)
+		if err := api.closeIssue(issue.Number, comment); err != nil {
+			return nil, err
+		}
+		result.Issue, result.IssueAction = issue.Number, "closed"
+	case len(result.Drifted) > 0:
+		title := envVar.Input.DriftIssueTitle
+		if title == "" {
+			title = fmt.Sprintf("Files out of sync with %s", driftSourceName(plan))
+		}
+		body := driftIssueBody(plan, marker, result.Drifted)
+		if issue == nil {
+			issue, err = api.createIssue(title, body)
+			result.IssueAction = "created"
+		} else {
+			err = api.updateIssue(issue.Number, map[string]any{"title": title, "body": body})
+			result.IssueAction = "updated"
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Issue = issue.Number
+	}
+	return result, nil
+}
+
+// driftMarker is the hidden comment identifying the tracking issue of a source and its destinations.
+func driftMarker(plan *Plan) string {
+	var destinations []string
+	if plan.File != nil {
+		destinations = append(destinations, plan.File.Path)
+	}
+	if envVar.Input.Directory != "" {
+		destinations = append(destinations, plan.DestinationDirectory)
+	}
+	return fmt.Sprintf("<!-- git-copy drift %s -> %s -->", driftSourceName(plan), strings.Join(destinations, ","))
+}
+
+// driftSourceName names the source in the tracking issue.
+func driftSourceName(plan *Plan) string {
+	if plan.Source.Archive != "" {
+		return plan.Source.Archive
+	}
+	if plan.Source.Repo != "" {
+		return plan.Source.Repo
+	}
+	return "the source"
+}
+
+// driftIssueBody renders the tracking issue: a table of the drifted files followed by
+// their diffs, which get the room the table leaves.
+func driftIssueBody(plan *Plan, marker string, drifted []FileChange) string {
+	lines := []string{
+		marker,
+		fmt.Sprintf("%d file(s) in `%s/%s` on `%s` differ from %s.", len(drifted), envVar.Input.Owner, envVar.Input.Repo, plan.CompareRef, plan.Source),
+		"",
+		"| File | Change | Lines |",
+		"| --- | --- | --- |",
+	}
+	listed := drifted
+	if len(listed) > maxDriftIssueRows {
+		listed = listed[:maxDriftIssueRows]
+	}
+	var changes []FileChange
+	for _, file := range listed {
+		stat := "-"
+		if file.Write() {
+			added, removed := diffStat(fileDiff(file))
+			stat = fmt.Sprintf("+%d -%d", added, removed)
+			changes = append(changes, file)
+		}
+		lines = append(lines, fmt.Sprintf("| `%s` | %s | %s |", file.Path, file.Action, stat))
+	}
+	if omitted := len(drifted) - len(listed); omitted > 0 {
+		lines = append(lines, "", fmt.Sprintf("...and %d more file(s) not listed to keep the issue within GitHub's size limit.", omitted))
+	}
+	lines = append(lines, "", "This issue is updated by git-copy and closed once the destination is back in sync.")
+	header := strings.Join(lines, "\n")
+	if diffs := FormatDiffs(changes, maxPullBodySize-len(header)-1024); len(diffs) > 0 {
+		header += "\n\n" + strings.Join(diffs, "\n")
+	}
+	return header
+}
+
+// diffStat counts the added and removed lines of a unified diff.
+func diffStat(diff string) (int, int) {
+	added, removed := 0, 0
+	for _, line := range strings.Split(diff, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			removed++
+		}
+	}
+	return added, removed
+}
+
+// findIssue returns the open issue whose body contains marker, or nil when there is none.
+func (c *apiClient) findIssue(marker string) (*Issue, error) {
+	for page := 1; ; page++ {
+		var issues []Issue
+		qs := url.Values{}
+		qs.Add("state", "open")
+		qs.Add("per_page", strconv.Itoa(issuesPerPage))
+		qs.Add("page", strconv.Itoa(page))
+		status, err := c.do(http.MethodGet, "issues", qs, nil, &issues)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("failed to list issues: %d", status)
+		}
+		for i := range issues {
+			if issues[i].PullRequest == nil && strings.Contains(issues[i].Body, marker) {
+				return &issues[i], nil
+			}
+		}
+		if len(issues) < issuesPerPage {
+			return nil, nil
+		}
+	}
+}
+
+// createIssue opens an issue.
+func (c *apiClient) createIssue(title string, body string) (*Issue, error) {
+	var issue Issue
+	status, err := c.do(http.MethodPost, "issues", nil, map[string]any{"title": title, "body": body}, &issue)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusCreated {
+		return nil, fmt.Errorf("failed to create issue: %d", status)
+	}
+	return &issue, nil
+}
+
+// updateIssue changes the given fields of an issue.
+func (c *apiClient) updateIssue(number int, fields map[string]any) error {
+	status, err := c.do(http.MethodPatch, fmt.Sprintf("issues/%d", number), nil, fields, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to update issue #%d: %d", number, status)
+	}
+	return nil
+}
+
+// closeIssue comments on an issue and closes it as completed.
+func (c *apiClient) closeIssue(number int, comment string) error {
+	status, err := c.do(http.MethodPost, fmt.Sprintf("issues/%d/comments", number), nil, map[string]any{"body": comment}, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("failed to comment on issue #%d: %d", number, status)
+	}
+	return c.updateIssue(number, map[string]any{"state": "closed", "state_reason": "completed"})
+}
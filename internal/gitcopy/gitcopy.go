@@ -1,45 +1,78 @@
 package gitcopy
 
 import (
-	b64 "encoding/base64"
-	"fmt"
 	"io"
 	"log"
 	"os"
-	"path/filepath"
-	"strings"
-	"time"
-
-	"github.com/google/uuid"
-	"github.com/pal-paul/go-libraries/pkg/env"
-	"github.com/pal-paul/go-libraries/pkg/git"
 )
 
 type Environment struct {
 	GitHub struct {
-		Token    string `env:"GITHUB_TOKEN,required=true"`
-		Api      string `env:"GITHUB_API_URL,required=true"`
-		Repo     string `env:"GITHUB_REPOSITORY,required=true"`
-		Workflow string `env:"GITHUB_WORKFLOW,required=true"`
-		Branch   string `env:"GITHUB_REF,required=true"`
-		Commit   string `env:"GITHUB_SHA,required=true"`
-		RunId    string `env:"GITHUB_RUN_ID,required=true"`
-		JobName  string `env:"GITHUB_JOB,required=true"`
-		Server   string `env:"GITHUB_SERVER_URL,required=true"`
+		Token    string `env:"GITHUB_TOKEN,required=true" flag:"token" help:"GitHub token with access to the destination repo"`
+		Api      string `env:"GITHUB_API_URL,default=https://api.github.com" flag:"api-url" help:"GitHub API URL"`
+		Repo     string `env:"GITHUB_REPOSITORY,required=false" flag:"github-repository" help:"source repository (owner/name)"`
+		Workflow string `env:"GITHUB_WORKFLOW,required=false" flag:"github-workflow" help:"name of the workflow running the copy"`
+		Branch   string `env:"GITHUB_REF,required=false" flag:"github-ref" help:"source ref"`
+		Commit   string `env:"GITHUB_SHA,required=false" flag:"github-sha" help:"source commit SHA"`
+		RunId    string `env:"GITHUB_RUN_ID,required=false" flag:"github-run-id" help:"workflow run ID"`
+		JobName  string `env:"GITHUB_JOB,required=false" flag:"github-job" help:"workflow job name"`
+		Server   string `env:"GITHUB_SERVER_URL,default=https://github.com" flag:"server-url" help:"GitHub server URL"`
 	}
 	Input struct {
-		Owner                string `env:"INPUT_OWNER,required=true"`
-		Repo                 string `env:"INPUT_REPO,required=true"`
-		FilePath             string `env:"INPUT_FILE_PATH,required=false"`
-		DestinationFilePath  string `env:"INPUT_DESTINATION_FILE_PATH,required=false"`
-		Directory            string `env:"INPUT_DIRECTORY,required=false"`
-		DestinationDirectory string `env:"INPUT_DESTINATION_DIRECTORY,required=false"`
-		PullMessage          string `env:"INPUT_PULL_MESSAGE,required=false"`
-		PullDescription      string `env:"INPUT_PULL_DESCRIPTION,required=false"`
-		Reviewers            string `env:"INPUT_REVIEWERS,required=false"`
-		TeamReviewers        string `env:"INPUT_TEAM_REVIEWERS,required=false"`
-		RefBranch            string `env:"INPUT_REF_BRANCH,default=master"`
-		Branch               string `env:"INPUT_BRANCH,default=update-branch"`
+		Owner                   string `env:"INPUT_OWNER,required=true" help:"owner of the destination repo"`
+		Repo                    string `env:"INPUT_REPO,required=true" help:"name of the destination repo"`
+		SourceOwner             string `env:"INPUT_SOURCE_OWNER,required=false" help:"owner of a source repo to read the files from through the API"`
+		SourceRepo              string `env:"INPUT_SOURCE_REPO,required=false" help:"name of a source repo to read the files from through the API"`
+		SourceRef               string `env:"INPUT_SOURCE_REF,required=false" help:"branch, tag or commit of the source repo (default branch when empty)"`
+		SourceArchive           string `env:"INPUT_SOURCE_ARCHIVE,required=false" help:"path or URL of a .tar.gz or .zip archive to read the files from"`
+		FilePath                string `env:"INPUT_FILE_PATH,required=false" help:"path to the source file"`
+		DestinationFilePath     string `env:"INPUT_DESTINATION_FILE_PATH,required=false" help:"path of the file in the destination repo"`
+		Directory               string `env:"INPUT_DIRECTORY,required=false" help:"path to the source directory"`
+		DestinationDirectory    string `env:"INPUT_DESTINATION_DIRECTORY,required=false" help:"path of the directory in the destination repo"`
+		AllowedDestinationPaths string `env:"INPUT_ALLOWED_DESTINATION_PATHS,required=false" help:"comma or newline separated patterns of the destination paths files may be written to"`
+		Symlinks                string `env:"INPUT_SYMLINKS,default=follow" help:"follow, preserve-as-link or skip symbolic links in the source directory"`
+		Rename                  string `env:"INPUT_RENAME,required=false" help:"newline or comma separated pattern -> target rules renaming the files of the directory"`
+		Flatten                 string `env:"INPUT_FLATTEN,default=false" help:"copy the files of the directory without their subdirectories"`
+		Normalize               string `env:"INPUT_NORMALIZE,required=false" help:"newline or comma separated pattern rules with eol=lf|crlf|keep, strip-bom and final-newline options"`
+		MaxFileSize             string `env:"INPUT_MAX_FILE_SIZE,required=false" help:"largest file to copy, such as 512KB or 10MB (default no limit)"`
+		MaxTotalSize            string `env:"INPUT_MAX_TOTAL_SIZE,required=false" help:"largest total size of the files written by a run (default no limit)"`
+		SkipBinary              string `env:"INPUT_SKIP_BINARY,default=false" help:"leave binary files out of the copy"`
+		SecretScan              string `env:"INPUT_SECRET_SCAN,default=off" help:"off, warn or block when the files to push look like they contain secrets"`
+		SecretPatterns          string `env:"INPUT_SECRET_PATTERNS,required=false" help:"newline separated regular expressions of additional secrets"`
+		SecretAllowlist         string `env:"INPUT_SECRET_ALLOWLIST,required=false" help:"file listing the paths, lines and matches the secret scan ignores"`
+		PullMessage             string `env:"INPUT_PULL_MESSAGE,required=false" help:"pull request title"`
+		PullDescription         string `env:"INPUT_PULL_DESCRIPTION,required=false" help:"pull request description"`
+		PrTitleTemplate         string `env:"INPUT_PR_TITLE_TEMPLATE,required=false" help:"Go template for the pull request title"`
+		PrBodyTemplate          string `env:"INPUT_PR_BODY_TEMPLATE,required=false" help:"Go template for the pull request body"`
+		CommitMessageTemplate   string `env:"INPUT_COMMIT_MESSAGE_TEMPLATE,required=false" help:"Go template for commit messages"`
+		CommitType              string `env:"INPUT_COMMIT_TYPE,required=false" help:"Conventional Commits type of the commit messages, such as chore"`
+		CommitScope             string `env:"INPUT_COMMIT_SCOPE,required=false" help:"Conventional Commits scope of the commit messages"`
+		CommitSignoff           string `env:"INPUT_COMMIT_SIGNOFF,default=false" help:"add a Signed-off-by trailer for the source commit author"`
+		CommitCoAuthor          string `env:"INPUT_COMMIT_CO_AUTHOR,default=false" help:"add a Co-authored-by trailer for the source commit author"`
+		CommitAuthorName        string `env:"INPUT_COMMIT_AUTHOR_NAME,required=false" help:"author name of the commits"`
+		CommitAuthorEmail       string `env:"INPUT_COMMIT_AUTHOR_EMAIL,required=false" help:"author email of the commits"`
+		CommitAuthorFromSource  string `env:"INPUT_COMMIT_AUTHOR_FROM_SOURCE,default=false" help:"use the author of the source commit as commit author"`
+		CommitterName           string `env:"INPUT_COMMITTER_NAME,required=false" help:"committer name of the commits"`
+		CommitterEmail          string `env:"INPUT_COMMITTER_EMAIL,required=false" help:"committer email of the commits"`
+		SigningKey              string `env:"INPUT_SIGNING_KEY,required=false" help:"armored GPG or OpenSSH private key to sign the commits with"`
+		SigningPassphrase       string `env:"INPUT_SIGNING_PASSPHRASE,required=false" help:"passphrase of the GPG signing key"`
+		Reviewers               string `env:"INPUT_REVIEWERS,required=false" help:"comma separated reviewers"`
+		TeamReviewers           string `env:"INPUT_TEAM_REVIEWERS,required=false" help:"comma separated team reviewers"`
+		CodeownersReviewers     string `env:"INPUT_CODEOWNERS_REVIEWERS,default=false" help:"request the destination CODEOWNERS of the changed files as reviewers"`
+		Labels                  string `env:"INPUT_LABELS,required=false" help:"comma separated labels for the pull request"`
+		Assignees               string `env:"INPUT_ASSIGNEES,required=false" help:"comma separated assignees for the pull request"`
+		Milestone               string `env:"INPUT_MILESTONE,required=false" help:"milestone number or title for the pull request"`
+		Draft                   string `env:"INPUT_DRAFT,default=false" help:"open the pull request as a draft"`
+		AutoMerge               string `env:"INPUT_AUTO_MERGE,required=false" help:"none, merge, squash or rebase to enable auto-merge on the pull request"`
+		RefBranch               string `env:"INPUT_REF_BRANCH,default=master" help:"base branch of the destination repo"`
+		Branch                  string `env:"INPUT_BRANCH,default=update-branch" help:"branch to push the copied files to"`
+		Mode                    string `env:"INPUT_MODE,default=pr" help:"pr to open a pull request, direct to commit onto the base branch or check to only report drift"`
+		DriftIssue              string `env:"INPUT_DRIFT_ISSUE,default=false" help:"in check mode, track drift in an issue of the destination repo and close it once in sync"`
+		DriftIssueTitle         string `env:"INPUT_DRIFT_ISSUE_TITLE,required=false" help:"title of the drift tracking issue"`
+		OnConflict              string `env:"INPUT_ON_CONFLICT,default=overwrite" help:"overwrite, skip, fail or annotate-pr for files modified since the last sync"`
+		LockFile                string `env:"INPUT_LOCK_FILE,required=false" help:"lockfile in the destination repo recording the last synced files"`
+		Merge                   string `env:"INPUT_MERGE,required=false" help:"none or three-way merge of files modified since the last sync"`
+		MergeConflicts          string `env:"INPUT_MERGE_CONFLICTS,default=markers" help:"markers or exclude for files whose merge conflicts"`
 	}
 }
 
@@ -47,8 +80,7 @@ var envVar Environment
 
 // InitializeEnvironment loads environment variables for the application
 func InitializeEnvironment() error {
-	_, err := env.Unmarshal(&envVar)
-	return err
+	return LoadEnvironment(nil)
 }
 
 // GetEnvironment returns the current environment configuration
@@ -64,24 +96,11 @@ func SetEnvironment(env Environment) {
 // IoReadDir recursively reads all files in a directory and its subdirectories
 func IoReadDir(root string) ([]string, error) {
 	var files []string
-	fileInfo, err := os.ReadDir(root)
-	if err != nil {
-		return files, err
-	}
-
-	for _, file := range fileInfo {
-		if file.IsDir() {
-			nestedFiles, err := IoReadDir(filepath.Join(root, file.Name()))
-			if err != nil {
-				log.Printf("ERROR: reading directory %s: %v", filepath.Join(root, file.Name()), err)
-				continue
-			}
-			files = append(files, nestedFiles...)
-		} else {
-			files = append(files, filepath.Join(root, file.Name()))
-		}
+	sourceFiles, err := ReadSourceDir(root, SymlinkFollow)
+	for _, file := range sourceFiles {
+		files = append(files, file.Path)
 	}
-	return files, nil
+	return files, err
 }
 
 // ReadFile reads the contents of a file
@@ -105,191 +124,7 @@ func ReadFile(path string) ([]byte, error) {
 
 // RunApplication executes the master application logic
 func RunApplication() {
-	var refBranch string
-
-	if envVar.Input.FilePath != "" && envVar.Input.DestinationFilePath == "" {
-		log.Fatal("ERROR: missing input 'destination_file file'")
-		return
-	}
-
-	if envVar.Input.Directory != "" && envVar.Input.DestinationDirectory == "" {
-		log.Fatal("ERROR: missing input 'destination-directory'")
-		return
-	}
-
-	if envVar.Input.FilePath == "" && envVar.Input.Directory == "" {
-		log.Fatal("ERROR: file or directory is required")
-		return
-	}
-
-	var gitReviewers git.Reviewers
-	if envVar.Input.Reviewers != "" {
-		envVar.Input.Reviewers = strings.ReplaceAll(envVar.Input.Reviewers, " ", "")
-		gitReviewers.Users = append(gitReviewers.Users, strings.Split(envVar.Input.Reviewers, ",")...)
-	}
-	if envVar.Input.TeamReviewers != "" {
-		envVar.Input.TeamReviewers = strings.ReplaceAll(envVar.Input.TeamReviewers, " ", "")
-		gitReviewers.Teams = append(gitReviewers.Teams, strings.Split(envVar.Input.TeamReviewers, ",")...)
-	}
-
-	if envVar.Input.Branch == "" {
-		envVar.Input.Branch = uuid.New().String()
-	}
-
-	// DO NOT EDIT BELOW THIS LINE
-	gitObj := git.New(
-		git.WithOwner(envVar.Input.Owner),
-		git.WithRepo(envVar.Input.Repo),
-		git.WithToken(envVar.GitHub.Token),
-	)
-
-	// Initialize branch handling for both file and directory operations
-	if envVar.Input.FilePath != "" || envVar.Input.Directory != "" {
-		refBranch = envVar.Input.RefBranch
-		refDefaultBranch, err := gitObj.GetBranch(refBranch)
-		if err != nil {
-			log.Fatal(err)
-		}
-		copyToBranch, err := gitObj.GetBranch(envVar.Input.Branch)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if copyToBranch == nil {
-			_, err = gitObj.CreateBranch(envVar.Input.Branch, refDefaultBranch.Object.Sha)
-			if err != nil {
-				log.Fatal(err)
-			}
-		} else {
-			refBranch = envVar.Input.Branch
-		}
-	}
-
-	var messages []string
-	if envVar.Input.PullDescription != "" {
-		messages = append(messages, envVar.Input.PullDescription)
-	}
-
-	if envVar.Input.FilePath != "" {
-		fileContent, err := ReadFile(envVar.Input.FilePath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		fileObj, err := gitObj.GetAFile(refBranch, envVar.Input.DestinationFilePath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		if fileObj == nil {
-			_, err = gitObj.CreateUpdateAFile(
-				envVar.Input.Branch,
-				envVar.Input.DestinationFilePath,
-				fileContent,
-				fmt.Sprintf("%s file created", envVar.Input.DestinationFilePath),
-				"",
-			)
-			if err != nil {
-				log.Fatal(err)
-			}
-			messages = append(messages, fmt.Sprintf("file %s created at %s", envVar.Input.DestinationFilePath, time.Now().Format("2006-01-02 15:04:05")))
-		} else {
-			encoded := b64.StdEncoding.EncodeToString(fileContent)
-			if encoded != fileObj.Content {
-				_, err = gitObj.CreateUpdateAFile(
-					envVar.Input.Branch,
-					envVar.Input.DestinationFilePath,
-					fileContent,
-					fmt.Sprintf("update file from source %s to destination %s", envVar.Input.FilePath, envVar.Input.DestinationFilePath),
-					fileObj.Sha,
-				)
-				if err != nil {
-					log.Fatal(err)
-				}
-			} else {
-				log.Printf("INFO: No changes detected for %s", envVar.Input.FilePath)
-			}
-			messages = append(messages, fmt.Sprintf("file %s updated to %s", envVar.Input.FilePath, envVar.Input.DestinationFilePath))
-		}
-		messages = append(messages, fmt.Sprintf("file %s updated to %s", envVar.Input.FilePath, envVar.Input.DestinationFilePath))
-	}
-
-	if envVar.Input.Directory != "" {
-		files, err := IoReadDir(envVar.Input.Directory)
-		if err != nil {
-			log.Fatal(err)
-		}
-		batch := git.BatchFileUpdate{
-			Branch:  envVar.Input.Branch,
-			Message: fmt.Sprintf("updates files from source %s to destination %s", envVar.Input.Directory, envVar.Input.DestinationDirectory),
-			Files:   make([]git.FileOperation, 0),
-		}
-
-		for _, file := range files {
-			relativePath, err := filepath.Rel(envVar.Input.Directory, file)
-			if err != nil {
-				log.Printf("ERROR: could not get relative path for %s: %v", file, err)
-				continue
-			}
-			destinationFile := filepath.Join(envVar.Input.DestinationDirectory, relativePath)
-
-			fileContent, err := ReadFile(file)
-			if err != nil {
-				continue
-			}
-
-			fileObj, err := gitObj.GetAFile(refBranch, destinationFile)
-			if err != nil {
-				continue
-			}
-
-			encoded := b64.StdEncoding.EncodeToString(fileContent)
-			fileOp := git.FileOperation{
-				Path:    destinationFile,
-				Content: encoded,
-			}
-			if fileObj != nil {
-				if encoded != fileObj.Content {
-					fileOp.Sha = fileObj.Sha
-					batch.Files = append(batch.Files, fileOp)
-				}
-			} else {
-				batch.Files = append(batch.Files, fileOp)
-			}
-		}
-
-		if len(batch.Files) > 0 {
-			err = gitObj.CreateUpdateMultipleFiles(batch)
-			if err != nil {
-				log.Fatal(err)
-			}
-			messages = append(messages, fmt.Sprintf("directory %s updated to %s", envVar.Input.Directory, envVar.Input.DestinationDirectory))
-			messages = append(messages, fmt.Sprintf("updated %d files in %s", len(batch.Files), envVar.Input.DestinationDirectory))
-		} else {
-			messages = append(messages, fmt.Sprintf("no files updated in %s", envVar.Input.DestinationDirectory))
-		}
-
-	}
-
-	if envVar.Input.PullMessage == "" {
-		envVar.Input.PullMessage = fmt.Sprintf("copy file(s) at %s", time.Now().Format("2006-01-02 15:04:05"))
-	}
-	envVar.Input.PullDescription = strings.Join(messages, "\n")
-
-	if envVar.Input.FilePath != "" || envVar.Input.Directory != "" {
-		if refBranch != envVar.Input.Branch {
-			prNumber, err := gitObj.CreatePullRequest(
-				refBranch,
-				envVar.Input.Branch,
-				envVar.Input.PullMessage,
-				envVar.Input.PullDescription,
-			)
-			if err != nil {
-				log.Fatal(err)
-			}
-			if gitReviewers.Users != nil || gitReviewers.Teams != nil {
-				err = gitObj.AddReviewers(prNumber, gitReviewers)
-				if err != nil {
-					log.Fatal(err)
-				}
-			}
-		}
+	if err := Run(CommandApply, os.Stdout); err != nil {
+		log.Fatalf("ERROR: %v", err)
 	}
 }
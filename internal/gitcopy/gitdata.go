@@ -0,0 +1,207 @@
+package gitcopy
+
+import (
+	b64 "encoding/base64"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+// commitIdentity is the author or committer of a commit.
+type commitIdentity struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// String formats the identity as used in git trailers.
+func (i commitIdentity) String() string {
+	return fmt.Sprintf("%s <%s>", i.Name, i.Email)
+}
+
+// newCommitWriter returns the writer for the configured commit identity and signing key.
+func newCommitWriter(api *apiClient, source SourceRevision) (*gitDataWriter, error) {
+	author, committer, err := commitIdentities(source)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := newSigner()
+	if err != nil {
+		return nil, err
+	}
+	if signer != nil {
+		// The signed payload has to name both, and GitHub only verifies a signature
+		// when the committer email belongs to the owner of the key
+		if committer == nil {
+			committer = author
+		}
+		if committer == nil {
+			return nil, fmt.Errorf("signed commits need committer_name and committer_email matching the signing key")
+		}
+		if author == nil {
+			author = committer
+		}
+	}
+	return &gitDataWriter{api: api, author: author, committer: committer, signer: signer}, nil
+}
+
+// commitIdentities reads the author and committer inputs. Either is nil when not configured.
+func commitIdentities(source SourceRevision) (*commitIdentity, *commitIdentity, error) {
+	fromSource, err := parseBool("commit_author_from_source", envVar.Input.CommitAuthorFromSource)
+	if err != nil {
+		return nil, nil, err
+	}
+	author, err := identityInput("commit_author", envVar.Input.CommitAuthorName, envVar.Input.CommitAuthorEmail)
+	if err != nil {
+		return nil, nil, err
+	}
+	committer, err := identityInput("committer", envVar.Input.CommitterName, envVar.Input.CommitterEmail)
+	if err != nil {
+		return nil, nil, err
+	}
+	if fromSource {
+		if author != nil {
+			return nil, nil, fmt.Errorf("commit_author_from_source cannot be combined with commit_author_name and commit_author_email")
+		}
+		author, err = sourceCommitAuthor(source)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to look up the source commit author: %w", err)
+		}
+		if author == nil {
+			return nil, nil, fmt.Errorf("commit_author_from_source needs GITHUB_REPOSITORY and GITHUB_SHA")
+		}
+	}
+	return author, committer, nil
+}
+
+// identityInput validates a name and email input pair.
+func identityInput(name string, userName string, email string) (*commitIdentity, error) {
+	if userName == "" && email == "" {
+		return nil, nil
+	}
+	if userName == "" || email == "" {
+		return nil, fmt.Errorf("%s_name and %s_email must be set together", name, name)
+	}
+	return &commitIdentity{Name: userName, Email: email}, nil
+}
+
+// gitDataWriter builds commits with the Git Data API: every blob is uploaded,
+// then a single tree and commit are created and the branch is moved once at the
+// end, so a failure leaves the branch untouched. Unlike the Contents API it
+// allows setting the author and committer and signing the commit.
+type gitDataWriter struct {
+	api       *apiClient
+	author    *commitIdentity
+	committer *commitIdentity
+	signer    signer
+}
+
+// commit writes files to the branch of plan as one commit and returns its SHA.
+// A branch that does not exist yet is created from the base branch pointing at the new commit.
+func (w *gitDataWriter) commit(plan *Plan, message string, files []FileChange) (string, error) {
+	branch := plan.Branch
+	parentSha := plan.BaseSha
+	if plan.BranchExists {
+		var ref struct {
+			Object struct {
+				Sha string `json:"sha"`
+			} `json:"object"`
+		}
+		status, err := w.api.do(http.MethodGet, "git/refs/heads/"+escapePath(branch), nil, nil, &ref)
+		if err != nil {
+			return "", err
+		}
+		if status != http.StatusOK {
+			return "", fmt.Errorf("failed to get branch %s: %d", branch, status)
+		}
+		parentSha = ref.Object.Sha
+	}
+	var parent struct {
+		Tree struct {
+			Sha string `json:"sha"`
+		} `json:"tree"`
+	}
+	status, err := w.api.do(http.MethodGet, "git/commits/"+parentSha, nil, nil, &parent)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", fmt.Errorf("failed to get commit %s: %d", parentSha, status)
+	}
+
+	entries := make([]map[string]string, 0, len(files))
+	for _, file := range files {
+		var blob struct {
+			Sha string `json:"sha"`
+		}
+		in := map[string]string{"content": b64.StdEncoding.EncodeToString(file.Content), "encoding": "base64"}
+		status, err := w.api.do(http.MethodPost, "git/blobs", nil, in, &blob)
+		if err != nil {
+			return "", err
+		}
+		if status != http.StatusCreated {
+			return "", fmt.Errorf("failed to create blob for %s: %d", file.Path, status)
+		}
+		entries = append(entries, map[string]string{"path": filepath.ToSlash(file.Path), "mode": file.GitMode(), "type": "blob", "sha": blob.Sha})
+	}
+
+	var tree struct {
+		Sha string `json:"sha"`
+	}
+	status, err = w.api.do(http.MethodPost, "git/trees", nil, map[string]any{"base_tree": parent.Tree.Sha, "tree": entries}, &tree)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusCreated {
+		return "", fmt.Errorf("failed to create tree: %d", status)
+	}
+
+	parents := []string{parentSha}
+	in := map[string]any{"message": message, "tree": tree.Sha, "parents": parents}
+	if w.author != nil {
+		in["author"] = w.author
+	}
+	if w.committer != nil {
+		in["committer"] = w.committer
+	}
+	if w.signer != nil {
+		// The dates are part of the signed payload, so they are set explicitly
+		date := time.Now().UTC().Truncate(time.Second)
+		in["author"] = map[string]string{"name": w.author.Name, "email": w.author.Email, "date": date.Format(time.RFC3339)}
+		in["committer"] = map[string]string{"name": w.committer.Name, "email": w.committer.Email, "date": date.Format(time.RFC3339)}
+		signature, err := w.signer.sign(commitPayload(tree.Sha, parents, *w.author, *w.committer, date, message))
+		if err != nil {
+			return "", err
+		}
+		in["signature"] = signature
+	}
+	var commit struct {
+		Sha string `json:"sha"`
+	}
+	status, err = w.api.do(http.MethodPost, "git/commits", nil, in, &commit)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusCreated {
+		return "", fmt.Errorf("failed to create commit: %d", status)
+	}
+
+	if plan.BranchExists {
+		status, err = w.api.do(http.MethodPatch, "git/refs/heads/"+escapePath(branch), nil, map[string]any{"sha": commit.Sha, "force": false}, nil)
+		if err != nil {
+			return "", err
+		}
+		if status != http.StatusOK {
+			return "", fmt.Errorf("failed to update branch %s: %d", branch, status)
+		}
+	} else {
+		status, err = w.api.do(http.MethodPost, "git/refs", nil, map[string]any{"ref": "refs/heads/" + branch, "sha": commit.Sha}, nil)
+		if err != nil {
+			return "", err
+		}
+		if status != http.StatusCreated {
+			return "", fmt.Errorf("failed to create branch %s: %d", branch, status)
+		}
+	}
+	return commit.Sha, nil
+}
@@ -0,0 +1,311 @@
+package gitcopy
+
+import (
+	"bytes"
+	b64 "encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pal-paul/go-libraries/pkg/git"
+)
+
+const (
+	defaultApiUrl    = "https://api.github.com"
+	defaultServerUrl = "https://github.com"
+)
+
+// newGitClient creates the git library client for the destination repository.
+func newGitClient() git.IGit {
+	return git.New(
+		git.WithOwner(envVar.Input.Owner),
+		git.WithRepo(envVar.Input.Repo),
+		git.WithToken(envVar.GitHub.Token),
+		git.WithBaseURL(envVar.GitHub.Api),
+	)
+}
+
+// apiClient covers the GitHub REST endpoints that the git library does not
+// expose, or does not expose in the shape git-copy needs.
+type apiClient struct {
+	baseUrl string
+	token   string
+	owner   string
+	repo    string
+	http    *http.Client
+}
+
+// newApiClient creates a client for the given repository using the token and
+// API URL from the loaded environment.
+func newApiClient(owner string, repo string) *apiClient {
+	return &apiClient{
+		baseUrl: apiBaseUrl(),
+		token:   envVar.GitHub.Token,
+		owner:   owner,
+		repo:    repo,
+		http:    &http.Client{},
+	}
+}
+
+// apiBaseUrl returns the configured REST API URL without a trailing slash.
+func apiBaseUrl() string {
+	baseUrl := strings.TrimSuffix(envVar.GitHub.Api, "/")
+	if baseUrl == "" {
+		return defaultApiUrl
+	}
+	return baseUrl
+}
+
+// do sends a request to the repository scoped path and decodes a JSON response
+// into out when it is non-nil. The HTTP status code is always returned so the
+// caller can decide which codes are acceptable.
+func (c *apiClient) do(method string, path string, qs url.Values, in any, out any) (int, error) {
+	u := fmt.Sprintf("%s/repos/%s/%s", c.baseUrl, c.owner, c.repo)
+	if path != "" {
+		u = u + "/" + path
+	}
+	if qs != nil {
+		u = u + "?" + qs.Encode()
+	}
+	return c.send(method, u, in, out)
+}
+
+// send sends a request to an absolute API URL, see do.
+func (c *apiClient) send(method string, u string, in any, out any) (int, error) {
+	var body io.Reader
+	if in != nil {
+		reqBody, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(reqBody)
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "token "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("ERROR: closing response body: %v", err)
+		}
+	}()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if out != nil && resp.StatusCode < 300 && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to parse response from %s: %w", u, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// graphqlUrl returns the GraphQL endpoint that belongs to the REST API URL.
+// GitHub Enterprise Server serves REST under /api/v3 and GraphQL under /api/graphql.
+func (c *apiClient) graphqlUrl() string {
+	if strings.HasSuffix(c.baseUrl, "/api/v3") {
+		return strings.TrimSuffix(c.baseUrl, "/v3") + "/graphql"
+	}
+	return c.baseUrl + "/graphql"
+}
+
+// graphql runs a GraphQL query and decodes its data into out when it is non-nil.
+// Errors reported in the response body are returned as an error.
+func (c *apiClient) graphql(query string, variables map[string]any, out any) error {
+	reqBody, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.graphqlUrl(), bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("ERROR: closing response body: %v", err)
+		}
+	}()
+
+	var result struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to parse GraphQL response: %d: %w", resp.StatusCode, err)
+	}
+	if len(result.Errors) > 0 {
+		messages := make([]string, 0, len(result.Errors))
+		for _, e := range result.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("GraphQL error: %s", strings.Join(messages, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GraphQL request failed: %d", resp.StatusCode)
+	}
+	if out != nil && len(result.Data) > 0 {
+		return json.Unmarshal(result.Data, out)
+	}
+	return nil
+}
+
+// authenticatedUser returns the login of the user the token belongs to, or an
+// empty string when the token is not a user token, as for GitHub Apps.
+func (c *apiClient) authenticatedUser() (string, error) {
+	var user struct {
+		Login string `json:"login"`
+	}
+	status, err := c.send(http.MethodGet, c.baseUrl+"/user", nil, &user)
+	if err != nil {
+		return "", err
+	}
+	if status != http.StatusOK {
+		return "", nil
+	}
+	return user.Login, nil
+}
+
+// getFile returns the file at path on ref, or nil when it does not exist.
+func (c *apiClient) getFile(ref string, filePath string) (*git.FileInfo, error) {
+	var fileInfo git.FileInfo
+	qs := url.Values{}
+	qs.Add("ref", ref)
+	status, err := c.do(http.MethodGet, "contents/"+escapePath(filePath), qs, nil, &fileInfo)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to get file %s: %d", filePath, status)
+	}
+	return &fileInfo, nil
+}
+
+// treeEntries returns the git file mode and blob SHA of every file in the tree of ref by path.
+func (c *apiClient) treeEntries(ref string) (map[string]treeEntry, error) {
+	var tree struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Mode string `json:"mode"`
+			Type string `json:"type"`
+			Sha  string `json:"sha"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	qs := url.Values{}
+	qs.Add("recursive", "1")
+	status, err := c.do(http.MethodGet, "git/trees/"+escapePath(ref), qs, nil, &tree)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to get tree of %s: %d", ref, status)
+	}
+	if tree.Truncated {
+		log.Printf("WARNING: the tree of %s is too large to list, file modes of unlisted files are not compared", ref)
+	}
+	entries := make(map[string]treeEntry, len(tree.Tree))
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" {
+			entries[entry.Path] = treeEntry{Mode: entry.Mode, Sha: entry.Sha}
+		}
+	}
+	return entries, nil
+}
+
+// getBlob returns the content of the blob with the given SHA, or nil when it does not exist.
+func (c *apiClient) getBlob(sha string) ([]byte, error) {
+	var blob struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	status, err := c.do(http.MethodGet, "git/blobs/"+sha, nil, nil, &blob)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusNotFound {
+		return nil, nil
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to get blob %s: %d", sha, status)
+	}
+	return decodeContent(&git.FileInfo{Content: blob.Content, Encoding: blob.Encoding})
+}
+
+// decodeContent returns the raw content of a file returned by the contents or blobs API.
+func decodeContent(fileInfo *git.FileInfo) ([]byte, error) {
+	switch fileInfo.Encoding {
+	case "base64":
+		return b64.StdEncoding.DecodeString(strings.ReplaceAll(fileInfo.Content, "\n", ""))
+	case "", "utf-8":
+		return []byte(fileInfo.Content), nil
+	default:
+		return nil, fmt.Errorf("unsupported content encoding %q", fileInfo.Encoding)
+	}
+}
+
+// PullRequest is the part of a pull request git-copy works with.
+type PullRequest struct {
+	Number  int    `json:"number"`
+	NodeId  string `json:"node_id"`
+	HtmlUrl string `json:"html_url"`
+	Title   string `json:"title"`
+	Draft   bool   `json:"draft"`
+}
+
+// findPullRequest returns the open pull request from head into base, or nil when there is none.
+func (c *apiClient) findPullRequest(head string, base string) (*PullRequest, error) {
+	var pulls []PullRequest
+	qs := url.Values{}
+	qs.Add("head", c.owner+":"+head)
+	qs.Add("base", base)
+	qs.Add("state", "open")
+	status, err := c.do(http.MethodGet, "pulls", qs, nil, &pulls)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to list pull requests: %d", status)
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return &pulls[0], nil
+}
+
+// escapePath escapes every segment of a repository path for use in a URL.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
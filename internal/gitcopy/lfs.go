@@ -0,0 +1,364 @@
+package gitcopy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// lfsPointerVersion is the first line of every Git LFS pointer file.
+	lfsPointerVersion = "version https://git-lfs.github.com/spec/v1"
+	// lfsPointerMaxSize is the largest file Git LFS considers to be a pointer.
+	lfsPointerMaxSize = 1024
+	lfsMediaType      = "application/vnd.git-lfs+json"
+)
+
+var lfsOidPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// LFSPointer identifies a Git LFS object.
+type LFSPointer struct {
+	Oid  string `json:"oid"` // SHA-256 of the object content
+	Size int64  `json:"size"`
+}
+
+// NewLFSPointer returns the pointer of content.
+func NewLFSPointer(content []byte) LFSPointer {
+	sum := sha256.Sum256(content)
+	return LFSPointer{Oid: hex.EncodeToString(sum[:]), Size: int64(len(content))}
+}
+
+// ParseLFSPointer reports whether data is a Git LFS pointer file and returns the object it points to.
+func ParseLFSPointer(data []byte) (LFSPointer, bool) {
+	var pointer LFSPointer
+	if len(data) > lfsPointerMaxSize || !bytes.HasPrefix(data, []byte(lfsPointerVersion+"\n")) {
+		return pointer, false
+	}
+	hasSize := false
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")[1:] {
+		key, value, ok := strings.Cut(line, " ")
+		if !ok {
+			return pointer, false
+		}
+		switch key {
+		case "oid":
+			pointer.Oid = strings.TrimPrefix(value, "sha256:")
+			if !strings.HasPrefix(value, "sha256:") || !lfsOidPattern.MatchString(pointer.Oid) {
+				return pointer, false
+			}
+		case "size":
+			size, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || size < 0 {
+				return pointer, false
+			}
+			pointer.Size = size
+			hasSize = true
+		}
+	}
+	return pointer, pointer.Oid != "" && hasSize
+}
+
+// Bytes formats the pointer file committed in place of the object.
+func (p LFSPointer) Bytes() []byte {
+	return []byte(fmt.Sprintf("%s\noid sha256:%s\nsize %d\n", lfsPointerVersion, p.Oid, p.Size))
+}
+
+// lfsObject is a file stored in Git LFS. content is nil when the source only holds the pointer.
+type lfsObject struct {
+	LFSPointer
+	content []byte
+}
+
+// lfsRule is a pattern of a .gitattributes file that sets or unsets the lfs filter.
+type lfsRule struct {
+	pattern *regexp.Regexp
+	lfs     bool
+}
+
+// LFSAttributes holds the patterns of a .gitattributes file that decide whether a path is stored in Git LFS.
+type LFSAttributes struct {
+	rules []lfsRule
+}
+
+// ParseLFSAttributes reads the filter attributes of a .gitattributes file. Lines with an
+// unsupported pattern are skipped.
+func ParseLFSAttributes(data []byte) *LFSAttributes {
+	attributes := &LFSAttributes{}
+	for number, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+		for _, attribute := range fields[1:] {
+			if attribute != "-filter" && attribute != "!filter" && !strings.HasPrefix(attribute, "filter=") {
+				continue
+			}
+			pattern, err := codeownersPattern(fields[0])
+			if err != nil {
+				log.Printf("WARNING: ignoring .gitattributes line %d: %v", number+1, err)
+				break
+			}
+			attributes.rules = append(attributes.rules, lfsRule{pattern: pattern, lfs: attribute == "filter=lfs"})
+		}
+	}
+	return attributes
+}
+
+// Tracked reports whether path is stored in Git LFS. The last matching pattern wins.
+func (a *LFSAttributes) Tracked(path string) bool {
+	for i := len(a.rules) - 1; i >= 0; i-- {
+		if a.rules[i].pattern.MatchString(path) {
+			return a.rules[i].lfs
+		}
+	}
+	return false
+}
+
+// loadLFSAttributes reads the .gitattributes file at the root of ref, returning nil when there is none.
+func loadLFSAttributes(api *apiClient, ref string) (*LFSAttributes, error) {
+	fileObj, err := api.getFile(ref, ".gitattributes")
+	if err != nil {
+		return nil, err
+	}
+	if fileObj == nil {
+		return nil, nil
+	}
+	data, err := decodeContent(fileObj)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode .gitattributes: %w", err)
+	}
+	return ParseLFSAttributes(data), nil
+}
+
+// lfsAction is a transfer the LFS server asks the client to make.
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// lfsBatchObject is an object in the response of the LFS batch API.
+type lfsBatchObject struct {
+	LFSPointer
+	Actions map[string]lfsAction `json:"actions"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// lfsClient talks to the Git LFS API of a repository.
+type lfsClient struct {
+	endpoint string
+	token    string
+	http     *http.Client
+}
+
+// newLFSClient creates a client for the LFS store of the given repository on the configured server.
+func newLFSClient(owner string, repo string) *lfsClient {
+	server := strings.TrimSuffix(envVar.GitHub.Server, "/")
+	if server == "" {
+		server = defaultServerUrl
+	}
+	return &lfsClient{
+		endpoint: fmt.Sprintf("%s/%s/%s.git/info/lfs", server, owner, repo),
+		token:    envVar.GitHub.Token,
+		http:     &http.Client{},
+	}
+}
+
+// batch asks the LFS server how to upload or download objects.
+func (c *lfsClient) batch(operation string, ref string, objects []LFSPointer) ([]lfsBatchObject, error) {
+	in := map[string]any{"operation": operation, "transfers": []string{"basic"}, "objects": objects}
+	if ref != "" {
+		in["ref"] = map[string]string{"name": ref}
+	}
+	reqBody, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, c.endpoint+"/objects/batch", bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", lfsMediaType)
+	req.Header.Set("Content-Type", lfsMediaType)
+	req.SetBasicAuth("x-access-token", c.token)
+
+	var out struct {
+		Objects []lfsBatchObject `json:"objects"`
+	}
+	status, err := c.send(req, &out)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("LFS batch %s request failed: %d", operation, status)
+	}
+	return out.Objects, nil
+}
+
+// transfer makes a request the LFS server asked for and returns the response body.
+func (c *lfsClient) transfer(method string, action lfsAction, body []byte, contentType string) ([]byte, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, action.Href, reader)
+	if err != nil {
+		return nil, err
+	}
+	// The action headers carry the authorization for the storage behind the LFS server
+	for key, value := range action.Header {
+		req.Header.Set(key, value)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	var out bytes.Buffer
+	status, err := c.send(req, &out)
+	if err != nil {
+		return nil, err
+	}
+	if status < 200 || status >= 300 {
+		return nil, fmt.Errorf("LFS %s %s failed: %d", method, action.Href, status)
+	}
+	return out.Bytes(), nil
+}
+
+// send sends req and reads the response into out, a *bytes.Buffer for raw content or a value to decode JSON into.
+func (c *lfsClient) send(req *http.Request, out any) (int, error) {
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			log.Printf("ERROR: closing response body: %v", err)
+		}
+	}()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, nil
+	}
+	if buf, ok := out.(*bytes.Buffer); ok {
+		buf.Write(respBody)
+		return resp.StatusCode, nil
+	}
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to parse response from %s: %w", req.URL, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// uploadLFSObjects uploads the LFS objects of files that the destination store does not
+// have yet. Objects the source only holds as pointers are downloaded from the LFS store of
+// the source repository first.
+func uploadLFSObjects(plan *Plan, files []FileChange) error {
+	objects := make(map[string]*lfsObject)
+	var pointers []LFSPointer
+	for _, file := range files {
+		if file.lfs == nil || objects[file.lfs.Oid] != nil {
+			continue
+		}
+		objects[file.lfs.Oid] = file.lfs
+		pointers = append(pointers, file.lfs.LFSPointer)
+	}
+	if len(pointers) == 0 {
+		return nil
+	}
+
+	destination := newLFSClient(envVar.Input.Owner, envVar.Input.Repo)
+	uploads, err := destination.batch("upload", "refs/heads/"+plan.Branch, pointers)
+	if err != nil {
+		return err
+	}
+	var pending []lfsBatchObject
+	var missing []LFSPointer
+	for _, upload := range uploads {
+		if upload.Error != nil {
+			return fmt.Errorf("LFS object %s was rejected: %s", upload.Oid, upload.Error.Message)
+		}
+		if _, ok := upload.Actions["upload"]; !ok {
+			// The store already has the object
+			continue
+		}
+		pending = append(pending, upload)
+		if objects[upload.Oid] != nil && objects[upload.Oid].content == nil {
+			missing = append(missing, upload.LFSPointer)
+		}
+	}
+	if err := downloadSourceLFSObjects(plan.Source.Repo, missing, objects); err != nil {
+		return err
+	}
+
+	for _, upload := range pending {
+		object := objects[upload.Oid]
+		if object == nil || object.content == nil {
+			return fmt.Errorf("LFS object %s is not available for upload", upload.Oid)
+		}
+		if _, err := destination.transfer(http.MethodPut, upload.Actions["upload"], object.content, "application/octet-stream"); err != nil {
+			return err
+		}
+		if verify, ok := upload.Actions["verify"]; ok {
+			body, err := json.Marshal(object.LFSPointer)
+			if err != nil {
+				return err
+			}
+			if _, err := destination.transfer(http.MethodPost, verify, body, lfsMediaType); err != nil {
+				return err
+			}
+		}
+	}
+	if len(pending) > 0 {
+		log.Printf("INFO: uploaded %d Git LFS object(s) to %s/%s", len(pending), envVar.Input.Owner, envVar.Input.Repo)
+	}
+	return nil
+}
+
+// downloadSourceLFSObjects fills in the content of pointers from the LFS store of the source repository.
+func downloadSourceLFSObjects(sourceRepo string, pointers []LFSPointer, objects map[string]*lfsObject) error {
+	if len(pointers) == 0 {
+		return nil
+	}
+	owner, repo, ok := strings.Cut(sourceRepo, "/")
+	if !ok {
+		return fmt.Errorf("%d LFS object(s) are only pointers in the source and the source repository is unknown", len(pointers))
+	}
+	source := newLFSClient(owner, repo)
+	downloads, err := source.batch("download", "", pointers)
+	if err != nil {
+		return err
+	}
+	for _, download := range downloads {
+		if download.Error != nil {
+			return fmt.Errorf("LFS object %s is not available in %s: %s", download.Oid, sourceRepo, download.Error.Message)
+		}
+		object := objects[download.Oid]
+		action, ok := download.Actions["download"]
+		if object == nil || !ok {
+			continue
+		}
+		content, err := source.transfer(http.MethodGet, action, nil, "")
+		if err != nil {
+			return err
+		}
+		if NewLFSPointer(content) != object.LFSPointer {
+			return fmt.Errorf("LFS object %s downloaded from %s does not match its pointer", download.Oid, sourceRepo)
+		}
+		object.content = content
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package gitcopy
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// binarySniffLength is how much of a file is inspected to tell binary from text, as git does.
+const binarySniffLength = 8000
+
+// sizeUnits are the suffixes accepted by ParseSize, longest first.
+var sizeUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+}
+
+// ParseSize parses a size such as 512KB, 10MB or 1048576. Units are powers of 1024.
+// An empty value means no limit and returns 0.
+func ParseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if number, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, unit = strings.TrimSpace(number), u.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a size such as 512KB or 10MB", value)
+	}
+	return int64(n * float64(unit)), nil
+}
+
+// FormatSize formats a number of bytes for reports.
+func FormatSize(n int64) string {
+	for _, u := range sizeUnits[:3] {
+		if n >= u.bytes {
+			return strconv.FormatFloat(float64(n)/float64(u.bytes), 'f', 1, 64) + " " + u.suffix
+		}
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// IsBinary reports whether content looks like a binary file, which is neither diffed, merged
+// nor normalized line by line: it has a NUL byte near the start.
+func IsBinary(content []byte) bool {
+	if len(content) > binarySniffLength {
+		content = content[:binarySniffLength]
+	}
+	return bytes.IndexByte(content, 0) >= 0
+}
+
+// copyLimits holds the max_file_size, max_total_size and skip_binary inputs and the
+// size of the files accepted so far.
+type copyLimits struct {
+	maxFile    int64 // 0 without a limit
+	maxTotal   int64 // 0 without a limit
+	skipBinary bool
+	total      int64
+}
+
+// parseCopyLimits reads the limit inputs.
+func parseCopyLimits() (*copyLimits, error) {
+	maxFile, err := ParseSize(envVar.Input.MaxFileSize)
+	if err != nil {
+		return nil, fmt.Errorf("max_file_size: %w", err)
+	}
+	maxTotal, err := ParseSize(envVar.Input.MaxTotalSize)
+	if err != nil {
+		return nil, fmt.Errorf("max_total_size: %w", err)
+	}
+	skipBinary, err := parseBool("skip_binary", envVar.Input.SkipBinary)
+	if err != nil {
+		return nil, err
+	}
+	return &copyLimits{maxFile: maxFile, maxTotal: maxTotal, skipBinary: skipBinary}, nil
+}
+
+// fileTooLarge returns why a file of size bytes is left out, or an empty string when it fits.
+func (l *copyLimits) fileTooLarge(size int64) string {
+	if l.maxFile > 0 && size > l.maxFile {
+		return fmt.Sprintf("%s is larger than max_file_size %s", FormatSize(size), FormatSize(l.maxFile))
+	}
+	return ""
+}
+
+// admit returns why the content a change writes is left out, or an empty string when it
+// is copied, in which case it counts towards max_total_size.
+func (l *copyLimits) admit(file *FileChange) string {
+	if file.GitMode() == gitModeSymlink {
+		return ""
+	}
+	size := int64(len(file.Content))
+	if l.skipBinary && IsBinary(file.Content) {
+		return "binary file, skip_binary is set"
+	}
+	if reason := l.fileTooLarge(size); reason != "" {
+		return reason
+	}
+	if l.maxTotal > 0 && l.total+size > l.maxTotal {
+		return fmt.Sprintf("copying its %s would exceed max_total_size %s", FormatSize(size), FormatSize(l.maxTotal))
+	}
+	l.total += size
+	return ""
+}
+
+// FormatExclusions renders the files left out of the copy, each with its reason, for the
+// pull request description.
+func FormatExclusions(files []FileChange) []string {
+	var lines []string
+	for _, file := range files {
+		if file.Excluded != "" {
+			lines = append(lines, fmt.Sprintf("- `%s`: %s", file.Path, file.Excluded))
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return append([]string{"Excluded files:"}, lines...)
+}
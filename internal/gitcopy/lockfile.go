@@ -0,0 +1,68 @@
+package gitcopy
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+const lockfileVersion = 1
+
+// Lockfile records, for every destination path, the blob git-copy wrote on
+// the last sync. A destination blob that no longer matches its entry was
+// changed by someone else since then.
+type Lockfile struct {
+	Version int                  `json:"version"`
+	Files   map[string]LockEntry `json:"files"`
+}
+
+// LockEntry describes the last synced state of a single destination file.
+type LockEntry struct {
+	Sha          string `json:"sha"`
+	Source       string `json:"source"`                // source path as given to the run
+	SourcePath   string `json:"source_path,omitempty"` // path in SourceRepo at SourceCommit
+	SourceRepo   string `json:"source_repo,omitempty"`
+	SourceCommit string `json:"source_commit,omitempty"`
+}
+
+// NewLockfile returns an empty lockfile.
+func NewLockfile() *Lockfile {
+	return &Lockfile{Version: lockfileVersion, Files: make(map[string]LockEntry)}
+}
+
+// ParseLockfile decodes a lockfile. Empty input yields an empty lockfile.
+func ParseLockfile(data []byte) (*Lockfile, error) {
+	lock := NewLockfile()
+	if len(data) == 0 {
+		return lock, nil
+	}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, fmt.Errorf("invalid lockfile: %w", err)
+	}
+	if lock.Version > lockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d", lock.Version)
+	}
+	if lock.Files == nil {
+		lock.Files = make(map[string]LockEntry)
+	}
+	return lock, nil
+}
+
+// Marshal encodes the lockfile with stable key order and a trailing newline.
+func (l *Lockfile) Marshal() ([]byte, error) {
+	l.Version = lockfileVersion
+	data, err := json.MarshalIndent(l, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// GitBlobSha returns the SHA git assigns to a blob with the given content.
+func GitBlobSha(content []byte) string {
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "blob %d\x00", len(content))
+	_, _ = h.Write(content)
+	return hex.EncodeToString(h.Sum(nil))
+}
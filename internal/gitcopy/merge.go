@@ -0,0 +1,152 @@
+package gitcopy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseMergeStrategy validates a merge input and reports whether three-way merging is enabled.
+func ParseMergeStrategy(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "none":
+		return false, nil
+	case "three-way":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid merge %q: expected none or three-way", value)
+	}
+}
+
+// MergeConflictMode decides what happens to files whose three-way merge has conflicts.
+type MergeConflictMode string
+
+const (
+	// MergeConflictMarkers commits the file with git style conflict markers.
+	MergeConflictMarkers MergeConflictMode = "markers"
+	// MergeConflictExclude leaves the file out of the commit.
+	MergeConflictExclude MergeConflictMode = "exclude"
+)
+
+// ParseMergeConflictMode validates a merge_conflicts input, defaulting to markers.
+func ParseMergeConflictMode(value string) (MergeConflictMode, error) {
+	switch mode := MergeConflictMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return MergeConflictMarkers, nil
+	case MergeConflictMarkers, MergeConflictExclude:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid merge_conflicts %q: expected markers or exclude", value)
+	}
+}
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	Content   []byte
+	Conflicts int
+}
+
+// ThreeWayMerge merges the changes made in ours and theirs since base. Regions
+// changed on both sides in different ways are emitted between conflict
+// markers labelled with oursLabel and theirsLabel.
+func ThreeWayMerge(base []byte, ours []byte, theirs []byte, oursLabel string, theirsLabel string) MergeResult {
+	baseLines := splitLines(string(base))
+	oursLines := splitLines(string(ours))
+	theirsLines := splitLines(string(theirs))
+
+	toOurs := matchLines(baseLines, oursLines)
+	toTheirs := matchLines(baseLines, theirsLines)
+
+	var out strings.Builder
+	result := MergeResult{}
+	b, o, t := 0, 0, 0
+	for b < len(baseLines) || o < len(oursLines) || t < len(theirsLines) {
+		// Copy lines that are unchanged on both sides.
+		stable := 0
+		for b+stable < len(baseLines) && toOurs[b+stable] == o+stable && toTheirs[b+stable] == t+stable {
+			stable++
+		}
+		if stable > 0 {
+			writeLines(&out, baseLines[b:b+stable], false)
+			b, o, t = b+stable, o+stable, t+stable
+			continue
+		}
+
+		// Find the next base line both sides still share and resolve the chunk before it.
+		next := b
+		for next < len(baseLines) && (toOurs[next] < 0 || toTheirs[next] < 0) {
+			next++
+		}
+		oEnd, tEnd := len(oursLines), len(theirsLines)
+		if next < len(baseLines) {
+			oEnd, tEnd = toOurs[next], toTheirs[next]
+		}
+
+		baseChunk := baseLines[b:next]
+		oursChunk := oursLines[o:oEnd]
+		theirsChunk := theirsLines[t:tEnd]
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			writeLines(&out, theirsChunk, false)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			writeLines(&out, oursChunk, false)
+		default:
+			result.Conflicts++
+			out.WriteString("<<<<<<< " + oursLabel + "\n")
+			writeLines(&out, oursChunk, true)
+			out.WriteString("=======\n")
+			writeLines(&out, theirsChunk, true)
+			out.WriteString(">>>>>>> " + theirsLabel + "\n")
+		}
+		b, o, t = next, oEnd, tEnd
+	}
+
+	result.Content = []byte(out.String())
+	return result
+}
+
+// FormatMerges renders the merged files for the pull request description.
+func FormatMerges(merged []string, marked []string, excluded []string) []string {
+	var lines []string
+	if len(merged) > 0 {
+		lines = append(lines, "Destination changes merged with the source:")
+		for _, path := range merged {
+			lines = append(lines, fmt.Sprintf("- `%s`", path))
+		}
+	}
+	if len(marked) > 0 {
+		lines = append(lines, "Files committed with merge conflict markers, resolve them before merging:")
+		for _, path := range marked {
+			lines = append(lines, fmt.Sprintf("- `%s`", path))
+		}
+	}
+	if len(excluded) > 0 {
+		lines = append(lines, "Files left out because the merge had conflicts:")
+		for _, path := range excluded {
+			lines = append(lines, fmt.Sprintf("- `%s`", path))
+		}
+	}
+	return lines
+}
+
+func equalLines(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// writeLines writes lines to out. With terminate set, a missing final newline is
+// added so that a following conflict marker starts on its own line.
+func writeLines(out *strings.Builder, lines []string, terminate bool) {
+	for _, line := range lines {
+		out.WriteString(line)
+	}
+	if terminate && len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		out.WriteString("\n")
+	}
+}
@@ -0,0 +1,117 @@
+package gitcopy
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// utf8BOM is the byte order mark some Windows editors put at the start of UTF-8 files.
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// Line endings of the eol option.
+const (
+	EOLKeep = "keep"
+	EOLLF   = "lf"
+	EOLCRLF = "crlf"
+)
+
+// normalizeOptions are the normalizations applied to a file.
+type normalizeOptions struct {
+	eol          string // EOLLF, EOLCRLF or EOLKeep, empty when not set
+	stripBOM     bool
+	finalNewline bool
+}
+
+// normalizeRule sets options for the paths matching pattern.
+type normalizeRule struct {
+	pattern *regexp.Regexp
+	options normalizeOptions
+}
+
+// Normalizer rewrites line endings, byte order marks and final newlines of text files
+// so that only real content changes count as differences.
+type Normalizer struct {
+	rules []normalizeRule
+}
+
+// ParseNormalizer reads the normalize input: rules separated by newlines or commas, each
+// a CODEOWNERS style pattern followed by options, as in a .gitattributes file:
+//
+//	*.md eol=lf strip-bom final-newline
+//	*.bat eol=crlf
+//
+// The options of every matching rule apply, later rules overriding the eol of earlier ones.
+func ParseNormalizer(value string) (*Normalizer, error) {
+	normalizer := &Normalizer{}
+	for _, line := range strings.Split(value, "\n") {
+		for _, item := range splitList(line) {
+			fields := strings.Fields(item)
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("invalid normalize rule %q: expected a pattern followed by eol=lf|crlf|keep, strip-bom or final-newline", item)
+			}
+			pattern, err := codeownersPattern(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid normalize rule %q: %w", item, err)
+			}
+			rule := normalizeRule{pattern: pattern}
+			for _, option := range fields[1:] {
+				switch option {
+				case "eol=" + EOLLF, "eol=" + EOLCRLF, "eol=" + EOLKeep:
+					rule.options.eol = strings.TrimPrefix(option, "eol=")
+				case "strip-bom":
+					rule.options.stripBOM = true
+				case "final-newline":
+					rule.options.finalNewline = true
+				default:
+					return nil, fmt.Errorf("invalid normalize rule %q: unknown option %q", item, option)
+				}
+			}
+			normalizer.rules = append(normalizer.rules, rule)
+		}
+	}
+	return normalizer, nil
+}
+
+// options merges the options of the rules matching path.
+func (n *Normalizer) options(path string) normalizeOptions {
+	var options normalizeOptions
+	for _, rule := range n.rules {
+		if !rule.pattern.MatchString(path) {
+			continue
+		}
+		if rule.options.eol != "" {
+			options.eol = rule.options.eol
+		}
+		options.stripBOM = options.stripBOM || rule.options.stripBOM
+		options.finalNewline = options.finalNewline || rule.options.finalNewline
+	}
+	return options
+}
+
+// Normalize returns content, the file at the destination path, with the options of the
+// rules matching path applied. Binary files are returned unchanged.
+func (n *Normalizer) Normalize(path string, content []byte) []byte {
+	if len(n.rules) == 0 || IsBinary(content) {
+		return content
+	}
+	options := n.options(path)
+	if options.stripBOM {
+		content = bytes.TrimPrefix(content, utf8BOM)
+	}
+	switch options.eol {
+	case EOLLF:
+		content = bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+	case EOLCRLF:
+		content = bytes.ReplaceAll(bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n")), []byte("\n"), []byte("\r\n"))
+	}
+	if options.finalNewline && len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		newline := "\n"
+		if options.eol == EOLCRLF {
+			newline = "\r\n"
+		}
+		content = append(content[:len(content):len(content)], newline...)
+	}
+	return content
+}
@@ -0,0 +1,641 @@
+package gitcopy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ChangeAction is what a run does with a single destination file.
+type ChangeAction string
+
+const (
+	ActionCreate    ChangeAction = "create"
+	ActionUpdate    ChangeAction = "update"
+	ActionUnchanged ChangeAction = "unchanged"
+	ActionSkip      ChangeAction = "skip"
+)
+
+// Mode is how the changes reach the destination branch.
+type Mode string
+
+const (
+	ModePullRequest Mode = "pr"
+	ModeDirect      Mode = "direct"
+	ModeCheck       Mode = "check" // compare only and report drift
+)
+
+// ParseMode validates the mode input. An empty value means pr.
+func ParseMode(value string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "", ModePullRequest:
+		return ModePullRequest, nil
+	case ModeDirect, ModeCheck:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid mode %q, expected pr, direct or check", value)
+	}
+}
+
+// FileChange is a source file and what happens to its copy in the destination repository.
+type FileChange struct {
+	Source    string
+	Path      string
+	Action    ChangeAction
+	Content   []byte // content to write
+	Previous  []byte // current destination content, nil when it does not exist
+	Sha       string // blob SHA of the destination file, empty when it does not exist
+	SourceSha string // blob SHA of the source content when Content holds a merge result
+	FileMode  string // git file mode of the source file, empty to keep the destination mode
+	// PreviousMode is the git file mode of the destination file, empty when it does not exist or is unknown
+	PreviousMode string
+	Excluded     string // why the file is left out by the size or binary limits, empty when it is copied
+
+	lfs *lfsObject // object stored in Git LFS, Content then holds its pointer
+}
+
+// GitMode returns the git file mode the file is written with.
+func (f FileChange) GitMode() string {
+	if f.FileMode != "" {
+		return f.FileMode
+	}
+	if f.PreviousMode != "" && f.PreviousMode != gitModeSymlink {
+		return f.PreviousMode
+	}
+	return gitModeFile
+}
+
+// ModeChanged reports whether the file mode differs from the destination file.
+func (f FileChange) ModeChanged() bool {
+	return f.PreviousMode != "" && f.GitMode() != f.PreviousMode
+}
+
+// Write reports whether the change has to be committed.
+func (f FileChange) Write() bool {
+	return f.Action == ActionCreate || f.Action == ActionUpdate
+}
+
+// OutOfSync reports whether the file differs from the destination. Excluded files are
+// left out on purpose and are not compared, so they never count.
+func (f FileChange) OutOfSync() bool {
+	return f.Action != ActionUnchanged && f.Excluded == ""
+}
+
+// lockSha returns the blob SHA recorded in the lockfile for the file, which is always the source version
+func (f FileChange) lockSha() string {
+	if f.SourceSha != "" {
+		return f.SourceSha
+	}
+	return GitBlobSha(f.Content)
+}
+
+// Plan describes what a run changes in the destination repository. It is
+// computed without writing anything, so the same plan backs the plan, diff,
+// status and apply commands.
+type Plan struct {
+	Mode           Mode
+	Source         SourceRevision
+	BaseBranch     string // destination branch the pull request targets
+	Branch         string // branch the changes are pushed to
+	BranchExists   bool   // whether Branch already exists in the destination
+	CompareRef     string // ref the destination content was read from
+	BaseSha        string // head commit of BaseBranch
+	ConflictPolicy ConflictPolicy
+	SecretScan     SecretScanMode
+
+	File                 *FileChange  // change for the file input, nil without one
+	Directory            []FileChange // changes for the directory input
+	DestinationDirectory string       // normalized destination_directory, empty without a directory input
+
+	Conflicts     []Conflict
+	Merged        []string
+	MergeMarked   []string
+	MergeExcluded []string
+	Secrets       []SecretFinding // possible secrets in the files to write
+
+	lock    *Lockfile
+	lockSha string
+}
+
+// Changes returns every file that has to be written.
+func (p *Plan) Changes() []FileChange {
+	var changes []FileChange
+	for _, file := range p.Files() {
+		if file.Write() {
+			changes = append(changes, file)
+		}
+	}
+	return changes
+}
+
+// Files returns every file considered by the plan.
+func (p *Plan) Files() []FileChange {
+	var files []FileChange
+	if p.File != nil {
+		files = append(files, *p.File)
+	}
+	return append(files, p.Directory...)
+}
+
+// InSync reports whether the destination already matches the source.
+func (p *Plan) InSync() bool {
+	for _, file := range p.Files() {
+		if file.OutOfSync() {
+			return false
+		}
+	}
+	return true
+}
+
+// validateInputs checks that the inputs describe something to copy
+func validateInputs() error {
+	if envVar.Input.FilePath != "" && envVar.Input.DestinationFilePath == "" {
+		return errors.New("missing input 'destination_file file'")
+	}
+	if envVar.Input.Directory != "" && envVar.Input.DestinationDirectory == "" {
+		return errors.New("missing input 'destination-directory'")
+	}
+	if envVar.Input.FilePath == "" && envVar.Input.Directory == "" {
+		return errors.New("file or directory is required")
+	}
+	if (envVar.Input.SourceOwner == "") != (envVar.Input.SourceRepo == "") {
+		return errors.New("source_owner and source_repo must be set together")
+	}
+	if envVar.Input.SourceRef != "" && envVar.Input.SourceRepo == "" {
+		return errors.New("source_ref requires source_owner and source_repo")
+	}
+	if envVar.Input.SourceArchive != "" && envVar.Input.SourceRepo != "" {
+		return errors.New("source_archive cannot be combined with source_repo")
+	}
+	return nil
+}
+
+// BuildPlan compares the source files with the destination repository and
+// works out what has to change. Nothing is written.
+func BuildPlan() (*Plan, error) {
+	if err := validateInputs(); err != nil {
+		return nil, err
+	}
+
+	mode, err := ParseMode(envVar.Input.Mode)
+	if err != nil {
+		return nil, err
+	}
+	conflictPolicy, err := ParseConflictPolicy(envVar.Input.OnConflict)
+	if err != nil {
+		return nil, err
+	}
+	mergeEnabled, err := ParseMergeStrategy(envVar.Input.Merge)
+	if err != nil {
+		return nil, err
+	}
+	mergeConflicts, err := ParseMergeConflictMode(envVar.Input.MergeConflicts)
+	if err != nil {
+		return nil, err
+	}
+	symlinks, err := ParseSymlinkPolicy(envVar.Input.Symlinks)
+	if err != nil {
+		return nil, err
+	}
+	limits, err := parseCopyLimits()
+	if err != nil {
+		return nil, err
+	}
+	normalizer, err := ParseNormalizer(envVar.Input.Normalize)
+	if err != nil {
+		return nil, err
+	}
+	secretScan, err := ParseSecretScanMode(envVar.Input.SecretScan)
+	if err != nil {
+		return nil, err
+	}
+	scanner, err := newConfiguredSecretScanner(secretScan)
+	if err != nil {
+		return nil, err
+	}
+	flatten, err := parseBool("flatten", envVar.Input.Flatten)
+	if err != nil {
+		return nil, err
+	}
+	renamer, err := NewPathRenamer(envVar.Input.Rename, flatten)
+	if err != nil {
+		return nil, err
+	}
+	allowlist, err := ParsePathAllowlist(envVar.Input.AllowedDestinationPaths)
+	if err != nil {
+		return nil, err
+	}
+	var destinationFile, destinationDirectory string
+	if envVar.Input.FilePath != "" {
+		if destinationFile, err = destinationFilePath(envVar.Input.DestinationFilePath); err != nil {
+			return nil, err
+		}
+		if err := allowlist.check(destinationFile); err != nil {
+			return nil, err
+		}
+	}
+	if envVar.Input.Directory != "" {
+		if destinationDirectory, err = DestinationPath(envVar.Input.DestinationDirectory); err != nil {
+			return nil, err
+		}
+	}
+	if envVar.Input.LockFile != "" {
+		lockFile, err := destinationFilePath(envVar.Input.LockFile)
+		if err != nil {
+			return nil, err
+		}
+		if err := allowlist.check(lockFile); err != nil {
+			return nil, err
+		}
+		envVar.Input.LockFile = lockFile
+	}
+	if (conflictPolicy != ConflictOverwrite || mergeEnabled) && envVar.Input.LockFile == "" {
+		log.Printf("WARNING: on_conflict and merge need a lock_file to detect destination changes")
+	}
+
+	if mode == ModeDirect || mode == ModeCheck {
+		envVar.Input.Branch = envVar.Input.RefBranch
+	} else if envVar.Input.Branch == "" {
+		envVar.Input.Branch = uuid.New().String()
+	}
+
+	gitObj := newGitClient()
+	api := newApiClient(envVar.Input.Owner, envVar.Input.Repo)
+
+	var source fileSource = &localSource{symlinks: symlinks}
+	revision := SourceRevision{Repo: envVar.GitHub.Repo, Commit: envVar.GitHub.Commit, Ref: envVar.GitHub.Branch}
+	if envVar.Input.SourceRepo != "" {
+		remote, err := newRemoteSource(envVar.Input.SourceOwner, envVar.Input.SourceRepo, envVar.Input.SourceRef, symlinks)
+		if err != nil {
+			return nil, err
+		}
+		source, revision = remote, remote.revision
+	}
+	if envVar.Input.SourceArchive != "" {
+		archive, err := newArchiveSource(envVar.Input.SourceArchive, symlinks)
+		if err != nil {
+			return nil, err
+		}
+		source, revision = archive, archive.revision
+	}
+
+	plan := &Plan{
+		Mode:           mode,
+		Source:         revision,
+		BaseBranch:     envVar.Input.RefBranch,
+		Branch:         envVar.Input.Branch,
+		CompareRef:     envVar.Input.RefBranch,
+		ConflictPolicy: conflictPolicy,
+		SecretScan:     secretScan,
+
+		DestinationDirectory: destinationDirectory,
+	}
+
+	refDefaultBranch, err := gitObj.GetBranch(plan.BaseBranch)
+	if err != nil {
+		return nil, err
+	}
+	if refDefaultBranch == nil {
+		return nil, fmt.Errorf("branch %s not found in %s/%s", plan.BaseBranch, envVar.Input.Owner, envVar.Input.Repo)
+	}
+	plan.BaseSha = refDefaultBranch.Object.Sha
+	if mode == ModeDirect || mode == ModeCheck {
+		// Changes are committed onto, or in check mode compared with, the base branch itself
+		plan.BranchExists = true
+	} else {
+		copyToBranch, err := gitObj.GetBranch(plan.Branch)
+		if err != nil {
+			return nil, err
+		}
+		if copyToBranch != nil {
+			plan.BranchExists = true
+			plan.CompareRef = plan.Branch
+		}
+	}
+
+	if envVar.Input.LockFile != "" {
+		plan.lock, plan.lockSha, err = loadLockfile(api, plan.CompareRef, envVar.Input.LockFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	state := &syncState{
+		api:            api,
+		plan:           plan,
+		merge:          mergeEnabled,
+		mergeConflicts: mergeConflicts,
+		limits:         limits,
+		normalizer:     normalizer,
+	}
+	state.lfs, err = loadLFSAttributes(api, plan.CompareRef)
+	if err != nil {
+		return nil, err
+	}
+
+	if envVar.Input.FilePath != "" {
+		fileContent, mode, err := source.readFile(envVar.Input.FilePath)
+		if err != nil {
+			return nil, err
+		}
+		file := FileChange{
+			Source:   envVar.Input.FilePath,
+			Path:     destinationFile,
+			Content:  fileContent,
+			FileMode: mode,
+		}
+		if err := state.evaluate(&file); err != nil {
+			return nil, err
+		}
+		state.limit(&file)
+		plan.File = &file
+	}
+
+	if envVar.Input.Directory != "" {
+		files, err := source.listDir(envVar.Input.Directory)
+		if err != nil {
+			return nil, err
+		}
+		directory := source.dirPath(envVar.Input.Directory)
+		sources := make(map[string]string, len(files))
+		for _, sourceFile := range files {
+			file := sourceFile.Path
+			relativePath, err := filepath.Rel(directory, file)
+			if err != nil || strings.HasPrefix(filepath.ToSlash(relativePath), "../") {
+				return nil, fmt.Errorf("%s is not inside directory %s", file, envVar.Input.Directory)
+			}
+			renamed, err := destinationFilePath(renamer.Rename(filepath.ToSlash(relativePath)))
+			if err != nil {
+				return nil, fmt.Errorf("invalid destination for %s: %w", file, err)
+			}
+			destinationFile := path.Join(destinationDirectory, renamed)
+			if err := allowlist.check(destinationFile); err != nil {
+				return nil, err
+			}
+			if other, ok := sources[destinationFile]; ok {
+				return nil, fmt.Errorf("%s and %s are both copied to %s", other, file, destinationFile)
+			}
+			sources[destinationFile] = file
+
+			if reason := limits.fileTooLarge(sourceFile.Size); reason != "" && !state.lfsTracked(destinationFile) {
+				// The file is left out without reading it
+				change := FileChange{Source: file, Path: destinationFile, FileMode: sourceFile.Mode}
+				exclude(&change, reason)
+				plan.Directory = append(plan.Directory, change)
+				continue
+			}
+
+			fileContent, err := source.read(sourceFile)
+			if err != nil {
+				log.Printf("ERROR: could not read %s: %v", file, err)
+				continue
+			}
+
+			change := FileChange{
+				Source:   file,
+				Path:     destinationFile,
+				Content:  fileContent,
+				FileMode: sourceFile.Mode,
+			}
+			if err := state.evaluate(&change); err != nil {
+				log.Printf("ERROR: could not get destination file %s: %v", destinationFile, err)
+				continue
+			}
+			state.limit(&change)
+			plan.Directory = append(plan.Directory, change)
+		}
+	}
+
+	if scanner != nil {
+		for _, file := range plan.Changes() {
+			plan.Secrets = append(plan.Secrets, scanFile(scanner, file)...)
+		}
+		for _, finding := range plan.Secrets {
+			log.Printf("WARNING: possible secret in %s", finding)
+		}
+	}
+
+	return plan, nil
+}
+
+// loadLockfile reads the lockfile from ref, returning an empty one when it does not exist yet
+func loadLockfile(api *apiClient, ref string, path string) (*Lockfile, string, error) {
+	fileObj, err := api.getFile(ref, path)
+	if err != nil {
+		return nil, "", err
+	}
+	if fileObj == nil {
+		return NewLockfile(), "", nil
+	}
+	data, err := decodeContent(fileObj)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode lockfile %s: %w", path, err)
+	}
+	lock, err := ParseLockfile(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return lock, fileObj.Sha, nil
+}
+
+// syncState holds what is needed to decide, file by file, what is written to the destination
+type syncState struct {
+	api            *apiClient
+	plan           *Plan
+	merge          bool
+	mergeConflicts MergeConflictMode
+	entries        map[string]treeEntry // destination file modes and SHAs, loaded on first use
+	lfs            *LFSAttributes       // LFS patterns of the destination, nil without a .gitattributes file
+	limits         *copyLimits
+	normalizer     *Normalizer
+}
+
+// destinationEntry returns the tree entry of path in the compared destination ref.
+func (s *syncState) destinationEntry(path string) (treeEntry, error) {
+	if s.entries == nil {
+		entries, err := s.api.treeEntries(s.plan.CompareRef)
+		if err != nil {
+			return treeEntry{}, err
+		}
+		s.entries = entries
+	}
+	return s.entries[filepath.ToSlash(path)], nil
+}
+
+// evaluate normalizes the content of file, looks up its destination copy and sets the action to take.
+// Files changed in the destination since the last sync are merged or handled by the conflict policy.
+func (s *syncState) evaluate(file *FileChange) error {
+	if file.GitMode() != gitModeSymlink {
+		file.Content = s.normalizer.Normalize(file.Path, file.Content)
+	}
+	s.trackLFS(file)
+	fileObj, err := s.api.getFile(s.plan.CompareRef, file.Path)
+	if err != nil {
+		return err
+	}
+	if fileObj == nil {
+		file.Action = ActionCreate
+		return nil
+	}
+	entry, err := s.destinationEntry(file.Path)
+	if err != nil {
+		return err
+	}
+	file.Sha, file.PreviousMode = fileObj.Sha, entry.Mode
+	if entry.Mode == gitModeSymlink {
+		// The contents API follows links to files of the repository, the tree holds the link itself
+		file.Sha = entry.Sha
+	}
+	if file.Sha == GitBlobSha(file.Content) {
+		file.Action = ActionUnchanged
+		if file.ModeChanged() {
+			file.Previous = file.Content
+			file.Action = ActionUpdate
+		}
+		return nil
+	}
+	if entry.Mode == gitModeSymlink {
+		if previous, err := s.api.getBlob(file.Sha); err == nil {
+			file.Previous = previous
+		}
+	} else if previous, err := decodeContent(fileObj); err == nil {
+		file.Previous = previous
+	}
+	file.Action = ActionUpdate
+
+	conflict := DetectConflict(s.plan.lock, file.Path, file.Sha)
+	if conflict == nil {
+		return nil
+	}
+	if s.merge {
+		err := s.mergeFile(file)
+		if err == nil {
+			return nil
+		}
+		log.Printf("WARNING: could not merge %s: %v", file.Path, err)
+	}
+
+	s.plan.Conflicts = append(s.plan.Conflicts, *conflict)
+	log.Printf("WARNING: %s was modified in the destination since the last sync (%s -> %s)",
+		conflict.Path, shortSha(conflict.LastSyncedSha), shortSha(conflict.CurrentSha))
+	if s.plan.ConflictPolicy == ConflictSkip {
+		file.Action = ActionSkip
+	}
+	return nil
+}
+
+// trackLFS keeps LFS pointers from the source as they are and replaces the content of
+// files the destination stores in Git LFS with their pointer.
+func (s *syncState) trackLFS(file *FileChange) {
+	if file.GitMode() == gitModeSymlink {
+		return
+	}
+	if pointer, ok := ParseLFSPointer(file.Content); ok {
+		file.lfs = &lfsObject{LFSPointer: pointer}
+		return
+	}
+	if s.lfsTracked(file.Path) {
+		pointer := NewLFSPointer(file.Content)
+		file.lfs = &lfsObject{LFSPointer: pointer, content: file.Content}
+		file.Content = pointer.Bytes()
+	}
+}
+
+// lfsTracked reports whether the destination stores path in Git LFS.
+func (s *syncState) lfsTracked(path string) bool {
+	return s.lfs != nil && s.lfs.Tracked(filepath.ToSlash(path))
+}
+
+// limit leaves out a change to write that breaks the size or binary limits.
+func (s *syncState) limit(file *FileChange) {
+	if !file.Write() {
+		return
+	}
+	if reason := s.limits.admit(file); reason != "" {
+		exclude(file, reason)
+	}
+}
+
+// exclude leaves file out of the copy for reason.
+func exclude(file *FileChange, reason string) {
+	file.Action = ActionSkip
+	file.Excluded = reason
+	log.Printf("WARNING: excluding %s: %s", file.Path, reason)
+}
+
+// mergeFile merges the destination edits of file with the new source content and
+// sets the resulting action. An error means the file could not be merged at all.
+func (s *syncState) mergeFile(file *FileChange) error {
+	if file.Previous == nil {
+		return fmt.Errorf("destination content is not available")
+	}
+	if file.GitMode() == gitModeSymlink || file.PreviousMode == gitModeSymlink {
+		return fmt.Errorf("symbolic links cannot be merged")
+	}
+	if file.lfs != nil {
+		return fmt.Errorf("files stored in Git LFS cannot be merged")
+	}
+	base, err := s.mergeBase(file.Path)
+	if err != nil {
+		return err
+	}
+	if IsBinary(base) || IsBinary(file.Previous) || IsBinary(file.Content) {
+		return fmt.Errorf("binary files cannot be merged")
+	}
+
+	sourceLabel := "source"
+	if s.plan.Source.Repo != "" && s.plan.Source.Commit != "" {
+		sourceLabel = fmt.Sprintf("source %s@%s", s.plan.Source.Repo, shortSha(s.plan.Source.Commit))
+	}
+	result := ThreeWayMerge(base, file.Previous, file.Content, "destination", sourceLabel)
+	file.SourceSha = GitBlobSha(file.Content)
+
+	if result.Conflicts > 0 {
+		log.Printf("WARNING: merging %s left %d conflict(s)", file.Path, result.Conflicts)
+		if s.mergeConflicts == MergeConflictExclude {
+			s.plan.MergeExcluded = append(s.plan.MergeExcluded, file.Path)
+			file.Action = ActionSkip
+			return nil
+		}
+		s.plan.MergeMarked = append(s.plan.MergeMarked, file.Path)
+		file.Content = result.Content
+		return nil
+	}
+
+	log.Printf("INFO: merged destination changes in %s", file.Path)
+	s.plan.Merged = append(s.plan.Merged, file.Path)
+	file.Content = result.Content
+	if GitBlobSha(file.Content) == file.Sha && !file.ModeChanged() {
+		file.Action = ActionUnchanged
+	}
+	return nil
+}
+
+// mergeBase returns the source version of path as of the last sync. It is read from the
+// destination repository first and from the source repository history as a fallback.
+func (s *syncState) mergeBase(path string) ([]byte, error) {
+	entry := s.plan.lock.Files[path]
+	content, err := s.api.getBlob(entry.Sha)
+	if err == nil && content != nil {
+		return content, nil
+	}
+	// Source is a path on the runner that synced last, so only SourcePath can be looked up
+	if entry.SourceRepo != "" && entry.SourceCommit != "" && entry.SourcePath != "" {
+		if owner, repo, ok := strings.Cut(entry.SourceRepo, "/"); ok {
+			source := newApiClient(owner, repo)
+			fileObj, err := source.getFile(entry.SourceCommit, entry.SourcePath)
+			if err != nil {
+				return nil, err
+			}
+			if fileObj != nil {
+				return decodeContent(fileObj)
+			}
+		}
+	}
+	return nil, fmt.Errorf("last synced version %s is not available", shortSha(entry.Sha))
+}
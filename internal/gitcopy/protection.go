@@ -0,0 +1,76 @@
+package gitcopy
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// branchProtection is the part of the classic branch protection that decides whether a direct push is accepted.
+type branchProtection struct {
+	RequiredStatusChecks *struct {
+		Contexts []string `json:"contexts"`
+	} `json:"required_status_checks"`
+	RequiredPullRequestReviews *struct{} `json:"required_pull_request_reviews"`
+	LockBranch                 *struct {
+		Enabled bool `json:"enabled"`
+	} `json:"lock_branch"`
+}
+
+// pushBlockers returns the reasons why branch protection or repository rules
+// would reject a commit pushed directly to branch. It is empty when the push is allowed.
+func (c *apiClient) pushBlockers(branch string) ([]string, error) {
+	var reasons []string
+
+	var info struct {
+		Protected  bool             `json:"protected"`
+		Protection branchProtection `json:"protection"`
+	}
+	status, err := c.do(http.MethodGet, "branches/"+escapePath(branch), nil, nil, &info)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to get branch %s: %d", branch, status)
+	}
+	if info.Protected {
+		// The full protection needs admin access; fall back to the summary included with the branch
+		protection := info.Protection
+		status, err := c.do(http.MethodGet, "branches/"+escapePath(branch)+"/protection", nil, nil, &protection)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK && status != http.StatusForbidden && status != http.StatusNotFound {
+			return nil, fmt.Errorf("failed to get protection of branch %s: %d", branch, status)
+		}
+		if protection.RequiredPullRequestReviews != nil {
+			reasons = append(reasons, "pull request reviews are required")
+		}
+		if protection.RequiredStatusChecks != nil && len(protection.RequiredStatusChecks.Contexts) > 0 {
+			reasons = append(reasons, "status checks are required")
+		}
+		if protection.LockBranch != nil && protection.LockBranch.Enabled {
+			reasons = append(reasons, "the branch is locked")
+		}
+	}
+
+	var rules []struct {
+		Type string `json:"type"`
+	}
+	status, err = c.do(http.MethodGet, "rules/branches/"+escapePath(branch), nil, nil, &rules)
+	if err != nil {
+		return nil, err
+	}
+	if status == http.StatusOK {
+		for _, rule := range rules {
+			switch rule.Type {
+			case "pull_request":
+				reasons = append(reasons, "a ruleset requires a pull request")
+			case "required_status_checks":
+				reasons = append(reasons, "a ruleset requires status checks")
+			case "update":
+				reasons = append(reasons, "a ruleset restricts updates")
+			}
+		}
+	}
+	return reasons, nil
+}
@@ -0,0 +1,243 @@
+package gitcopy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PullOptions are the settings applied to the pull request on top of the reviewers.
+type PullOptions struct {
+	Labels    []string
+	Assignees []string
+	Milestone string // milestone number or title
+	Draft     bool
+	AutoMerge string // GraphQL merge method for auto-merge, empty when disabled
+
+	CodeownersReviewers bool // request the destination code owners of the changed files as reviewers
+}
+
+// ParsePullOptions reads the pull request settings from the loaded environment.
+func ParsePullOptions() (PullOptions, error) {
+	draft, err := parseBool("draft", envVar.Input.Draft)
+	if err != nil {
+		return PullOptions{}, err
+	}
+	autoMerge, err := ParseAutoMerge(envVar.Input.AutoMerge)
+	if err != nil {
+		return PullOptions{}, err
+	}
+	codeowners, err := parseBool("codeowners_reviewers", envVar.Input.CodeownersReviewers)
+	if err != nil {
+		return PullOptions{}, err
+	}
+	return PullOptions{
+		Labels:    splitList(envVar.Input.Labels),
+		Assignees: splitList(envVar.Input.Assignees),
+		Milestone: strings.TrimSpace(envVar.Input.Milestone),
+		Draft:     draft,
+		AutoMerge: autoMerge,
+
+		CodeownersReviewers: codeowners,
+	}, nil
+}
+
+// ParseAutoMerge validates the auto_merge input and returns the matching GraphQL
+// merge method. An empty value or none disables auto-merge.
+func ParseAutoMerge(value string) (string, error) {
+	switch method := strings.ToLower(strings.TrimSpace(value)); method {
+	case "", "none":
+		return "", nil
+	case "merge", "squash", "rebase":
+		return strings.ToUpper(method), nil
+	default:
+		return "", fmt.Errorf("invalid auto_merge value %q, expected none, merge, squash or rebase", value)
+	}
+}
+
+// appendUnique appends the items that are not in list yet.
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		if !slices.Contains(list, item) {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// splitList splits a comma separated input, dropping blanks around and between the items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseBool parses a true or false input, treating an empty value as false.
+func parseBool(name string, value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value %q, expected true or false", name, value)
+	}
+	return b, nil
+}
+
+// createPullRequest opens a pull request from head into base.
+func (c *apiClient) createPullRequest(base string, head string, title string, body string, draft bool) (*PullRequest, error) {
+	in := map[string]any{
+		"title": title,
+		"head":  head,
+		"base":  base,
+		"body":  body,
+		"draft": draft,
+	}
+	var pull PullRequest
+	status, err := c.do(http.MethodPost, "pulls", nil, in, &pull)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusCreated {
+		return nil, fmt.Errorf("failed to create pull request: %d", status)
+	}
+	return &pull, nil
+}
+
+// updatePullRequest replaces the title and description of a pull request.
+func (c *apiClient) updatePullRequest(number int, title string, body string) error {
+	status, err := c.do(http.MethodPatch, fmt.Sprintf("pulls/%d", number), nil, map[string]any{"title": title, "body": body}, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to update pull request #%d: %d", number, status)
+	}
+	return nil
+}
+
+// addLabels adds labels to the pull request, creating the ones the repository does not have yet.
+func (c *apiClient) addLabels(number int, labels []string) error {
+	status, err := c.do(http.MethodPost, fmt.Sprintf("issues/%d/labels", number), nil, map[string]any{"labels": labels}, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to add labels to pull request #%d: %d", number, status)
+	}
+	return nil
+}
+
+// addAssignees assigns users to the pull request.
+func (c *apiClient) addAssignees(number int, assignees []string) error {
+	status, err := c.do(http.MethodPost, fmt.Sprintf("issues/%d/assignees", number), nil, map[string]any{"assignees": assignees}, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated {
+		return fmt.Errorf("failed to add assignees to pull request #%d: %d", number, status)
+	}
+	return nil
+}
+
+// findMilestone resolves a milestone number or the title of an open milestone to its number.
+func (c *apiClient) findMilestone(milestone string) (int, error) {
+	if number, err := strconv.Atoi(milestone); err == nil {
+		return number, nil
+	}
+	var milestones []struct {
+		Number int    `json:"number"`
+		Title  string `json:"title"`
+	}
+	qs := url.Values{}
+	qs.Add("state", "open")
+	qs.Add("per_page", "100")
+	status, err := c.do(http.MethodGet, "milestones", qs, nil, &milestones)
+	if err != nil {
+		return 0, err
+	}
+	if status != http.StatusOK {
+		return 0, fmt.Errorf("failed to list milestones: %d", status)
+	}
+	for _, m := range milestones {
+		if m.Title == milestone {
+			return m.Number, nil
+		}
+	}
+	return 0, fmt.Errorf("milestone %q not found in %s/%s", milestone, c.owner, c.repo)
+}
+
+// setMilestone sets the milestone of the pull request.
+func (c *apiClient) setMilestone(number int, milestone int) error {
+	status, err := c.do(http.MethodPatch, fmt.Sprintf("issues/%d", number), nil, map[string]any{"milestone": milestone}, nil)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("failed to set milestone of pull request #%d: %d", number, status)
+	}
+	return nil
+}
+
+// decoratePullRequest applies the labels, assignees and milestone to the pull request.
+func (c *apiClient) decoratePullRequest(pull *PullRequest, options PullOptions) error {
+	if len(options.Labels) > 0 {
+		if err := c.addLabels(pull.Number, options.Labels); err != nil {
+			return err
+		}
+	}
+	if len(options.Assignees) > 0 {
+		if err := c.addAssignees(pull.Number, options.Assignees); err != nil {
+			return err
+		}
+	}
+	if options.Milestone != "" {
+		milestone, err := c.findMilestone(options.Milestone)
+		if err != nil {
+			return err
+		}
+		if err := c.setMilestone(pull.Number, milestone); err != nil {
+			return err
+		}
+	}
+	if options.Draft && !pull.Draft {
+		if err := c.convertToDraft(pull); err != nil {
+			return fmt.Errorf("failed to convert pull request #%d to a draft: %w", pull.Number, err)
+		}
+		pull.Draft = true
+	}
+	return nil
+}
+
+// convertToDraft turns an open pull request back into a draft, which the REST API cannot do.
+func (c *apiClient) convertToDraft(pull *PullRequest) error {
+	if pull.NodeId == "" {
+		return fmt.Errorf("node id of pull request #%d is unknown", pull.Number)
+	}
+	query := `mutation($id: ID!) {
+  convertPullRequestToDraft(input: {pullRequestId: $id}) {
+    pullRequest { number }
+  }
+}`
+	return c.graphql(query, map[string]any{"id": pull.NodeId}, nil)
+}
+
+// enableAutoMerge turns on auto-merge for the pull request with the given merge method.
+func (c *apiClient) enableAutoMerge(pull *PullRequest, method string) error {
+	if pull.NodeId == "" {
+		return fmt.Errorf("node id of pull request #%d is unknown", pull.Number)
+	}
+	query := `mutation($id: ID!, $method: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) {
+    pullRequest { number }
+  }
+}`
+	return c.graphql(query, map[string]any{"id": pull.NodeId, "method": method}, nil)
+}
@@ -0,0 +1,87 @@
+package gitcopy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// newRemoteSource reads the files from another repository through the API. ref, or the
+// default branch when it is empty, is resolved and its recursive tree listed; blobs are
+// fetched as they are needed.
+func newRemoteSource(owner string, repo string, ref string, symlinks SymlinkPolicy) (*treeSource, error) {
+	api := newApiClient(owner, repo)
+	if ref == "" {
+		var repository struct {
+			DefaultBranch string `json:"default_branch"`
+		}
+		status, err := api.do(http.MethodGet, "", nil, nil, &repository)
+		if err != nil {
+			return nil, err
+		}
+		if status != http.StatusOK {
+			return nil, fmt.Errorf("failed to get source repository %s/%s: %d", owner, repo, status)
+		}
+		ref = repository.DefaultBranch
+	}
+
+	var commit struct {
+		Sha    string `json:"sha"`
+		Commit struct {
+			Tree struct {
+				Sha string `json:"sha"`
+			} `json:"tree"`
+		} `json:"commit"`
+	}
+	status, err := api.do(http.MethodGet, "commits/"+escapePath(ref), nil, nil, &commit)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to resolve source ref %s in %s/%s: %d", ref, owner, repo, status)
+	}
+
+	var tree struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Mode string `json:"mode"`
+			Type string `json:"type"`
+			Sha  string `json:"sha"`
+			Size int64  `json:"size"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	qs := url.Values{}
+	qs.Add("recursive", "1")
+	status, err = api.do(http.MethodGet, "git/trees/"+commit.Commit.Tree.Sha, qs, nil, &tree)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("failed to get the tree of %s in %s/%s: %d", ref, owner, repo, status)
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("the tree of %s in %s/%s is too large to list through the API", ref, owner, repo)
+	}
+
+	source := &treeSource{
+		symlinks: symlinks,
+		revision: SourceRevision{Repo: owner + "/" + repo, Commit: commit.Sha, Ref: ref, Remote: true},
+		entries:  make(map[string]treeEntry, len(tree.Tree)),
+		fetch: func(sha string) ([]byte, error) {
+			content, err := api.getBlob(sha)
+			if err == nil && content == nil {
+				err = fmt.Errorf("blob %s not found in %s/%s", sha, owner, repo)
+			}
+			return content, err
+		},
+	}
+	for _, entry := range tree.Tree {
+		if entry.Type == "blob" {
+			source.entries[entry.Path] = treeEntry{Mode: entry.Mode, Sha: entry.Sha, Size: entry.Size}
+		}
+	}
+	log.Printf("INFO: reading the source from %s", source.revision)
+	return source, nil
+}
@@ -0,0 +1,173 @@
+package gitcopy
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// renameRegexPrefix marks a rename rule whose pattern is a regular expression.
+const renameRegexPrefix = "regex:"
+
+// renameRule rewrites the paths matching pattern. For glob rules every wildcard of
+// the pattern is a capture group and target holds the literal text between the
+// wildcards; basename rules only rewrite the last path segment.
+type renameRule struct {
+	pattern  *regexp.Regexp
+	regex    bool
+	basename bool
+	target   []string
+	template string
+}
+
+// PathRenamer maps the paths of a directory copy, relative to the source directory,
+// to their paths relative to the destination directory.
+type PathRenamer struct {
+	rules   []renameRule
+	flatten bool
+}
+
+// NewPathRenamer parses the rename input, a list of "pattern -> target" rules separated
+// by newlines or commas; a regex: rule takes the rest of its line, commas included, so
+// quantifiers such as {1,2} work. The first matching rule applies. Glob patterns support *, ** and
+// ?, and the target reuses what they matched in order; a pattern without a slash matches
+// the file name in any directory. Patterns prefixed with regex: are regular expressions
+// matched against the whole path, with $1 style references in the target. With flatten
+// the directories of the renamed path are dropped.
+func NewPathRenamer(rename string, flatten bool) (*PathRenamer, error) {
+	renamer := &PathRenamer{flatten: flatten}
+	for _, line := range strings.Split(rename, "\n") {
+		for line != "" {
+			item, rest, _ := strings.Cut(line, ",")
+			if strings.HasPrefix(strings.TrimSpace(item), renameRegexPrefix) {
+				item, rest = line, ""
+			}
+			line = rest
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			rule, err := parseRenameRule(item)
+			if err != nil {
+				return nil, err
+			}
+			renamer.rules = append(renamer.rules, rule)
+		}
+	}
+	return renamer, nil
+}
+
+// parseRenameRule parses a single "pattern -> target" rule.
+func parseRenameRule(value string) (renameRule, error) {
+	from, to, ok := strings.Cut(value, "->")
+	from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+	if !ok || from == "" || to == "" {
+		return renameRule{}, fmt.Errorf("invalid rename rule %q: expected pattern -> target", value)
+	}
+
+	if expr, ok := strings.CutPrefix(from, renameRegexPrefix); ok {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return renameRule{}, fmt.Errorf("invalid rename rule %q: %w", value, err)
+		}
+		return renameRule{pattern: pattern, regex: true, template: to}, nil
+	}
+
+	rule := renameRule{basename: !strings.Contains(from, "/")}
+	var expr strings.Builder
+	expr.WriteString("^")
+	wildcards := 0
+	for i := 0; i < len(from); i++ {
+		switch {
+		case strings.HasPrefix(from[i:], "**"):
+			expr.WriteString("(.*)")
+			wildcards++
+			i++
+		case from[i] == '*':
+			expr.WriteString("([^/]*)")
+			wildcards++
+		case from[i] == '?':
+			expr.WriteString("([^/])")
+			wildcards++
+		default:
+			expr.WriteString(regexp.QuoteMeta(from[i : i+1]))
+		}
+	}
+	expr.WriteString("$")
+	pattern, err := regexp.Compile(expr.String())
+	if err != nil {
+		return renameRule{}, fmt.Errorf("invalid rename rule %q: %w", value, err)
+	}
+	rule.pattern = pattern
+
+	// The target is split on its wildcards, each of which takes the next capture
+	rule.target = splitWildcards(to)
+	if len(rule.target)-1 > wildcards {
+		return renameRule{}, fmt.Errorf("invalid rename rule %q: the target has more wildcards than the pattern", value)
+	}
+	return rule, nil
+}
+
+// splitWildcards splits a glob target into the literal text around its *, ** and ? wildcards.
+func splitWildcards(target string) []string {
+	var parts []string
+	var literal strings.Builder
+	for i := 0; i < len(target); i++ {
+		switch {
+		case strings.HasPrefix(target[i:], "**"):
+			parts = append(parts, literal.String())
+			literal.Reset()
+			i++
+		case target[i] == '*' || target[i] == '?':
+			parts = append(parts, literal.String())
+			literal.Reset()
+		default:
+			literal.WriteByte(target[i])
+		}
+	}
+	return append(parts, literal.String())
+}
+
+// Rename returns the destination path of relativePath, a slash separated path.
+func (r *PathRenamer) Rename(relativePath string) string {
+	for _, rule := range r.rules {
+		if renamed, ok := rule.apply(relativePath); ok {
+			relativePath = renamed
+			break
+		}
+	}
+	if r.flatten {
+		relativePath = path.Base(relativePath)
+	}
+	return relativePath
+}
+
+// apply rewrites relativePath when the rule matches it.
+func (rule renameRule) apply(relativePath string) (string, bool) {
+	if rule.regex {
+		match := rule.pattern.FindStringSubmatchIndex(relativePath)
+		if match == nil {
+			return "", false
+		}
+		renamed := rule.pattern.ExpandString(nil, rule.template, relativePath, match)
+		return relativePath[:match[0]] + string(renamed) + relativePath[match[1]:], true
+	}
+
+	dir, name := "", relativePath
+	if rule.basename {
+		dir, name = path.Split(relativePath)
+	}
+	captures := rule.pattern.FindStringSubmatch(name)
+	if captures == nil {
+		return "", false
+	}
+	var renamed strings.Builder
+	renamed.WriteString(dir)
+	for i, literal := range rule.target {
+		if i > 0 {
+			renamed.WriteString(captures[i])
+		}
+		renamed.WriteString(literal)
+	}
+	return renamed.String(), true
+}
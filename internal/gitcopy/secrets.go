@@ -0,0 +1,275 @@
+package gitcopy
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SecretScanMode decides what happens when a file about to be pushed looks like it contains a secret.
+type SecretScanMode string
+
+const (
+	// SecretScanOff does not scan the files.
+	SecretScanOff SecretScanMode = "off"
+	// SecretScanWarn reports the findings and pushes the files anyway.
+	SecretScanWarn SecretScanMode = "warn"
+	// SecretScanBlock aborts the run before anything is written.
+	SecretScanBlock SecretScanMode = "block"
+)
+
+// ParseSecretScanMode validates a secret_scan input. An empty value selects SecretScanOff.
+func ParseSecretScanMode(value string) (SecretScanMode, error) {
+	switch mode := SecretScanMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return SecretScanOff, nil
+	case SecretScanOff, SecretScanWarn, SecretScanBlock:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("invalid secret_scan %q: expected off, warn or block", value)
+	}
+}
+
+const (
+	// highEntropyRule names the findings of the entropy check.
+	highEntropyRule = "high-entropy-string"
+	// highEntropyMinLength is the shortest token checked for entropy. The entropy of a
+	// token cannot exceed log2 of its length, so shorter tokens never pass the threshold
+	// of 4.5 bits: log2 of 22 is 4.46, log2 of 23 is 4.52.
+	highEntropyMinLength = 23
+	// highEntropyThreshold is the Shannon entropy, in bits per character, above which a
+	// token is reported. Hex digests stay below it, base64 encoded keys usually exceed it.
+	highEntropyThreshold = 4.5
+)
+
+// secretRule is a pattern of a kind of credential.
+type secretRule struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// builtinSecretRules detect common credentials.
+var builtinSecretRules = []secretRule{
+	{name: "github-token", pattern: regexp.MustCompile(`\bgh[pousr]_[A-Za-z0-9]{36,255}\b`)},
+	{name: "github-fine-grained-token", pattern: regexp.MustCompile(`\bgithub_pat_[A-Za-z0-9_]{22,255}\b`)},
+	{name: "aws-access-key-id", pattern: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[A-Z0-9]{16}\b`)},
+	{name: "aws-secret-access-key", pattern: regexp.MustCompile(`(?i)aws.{0,20}(?:secret|key).{0,20}['"=:\s][A-Za-z0-9/+]{40}\b`)},
+	{name: "private-key", pattern: regexp.MustCompile(`-----BEGIN (?:[A-Z0-9]+ )*PRIVATE KEY(?: BLOCK)?-----`)},
+}
+
+// highEntropyToken finds the candidates of the entropy check.
+var highEntropyToken = regexp.MustCompile(`[A-Za-z0-9+/_\-]{` + strconv.Itoa(highEntropyMinLength) + `,}={0,2}`)
+
+// SecretFinding is a line of a file that looks like it contains a secret.
+type SecretFinding struct {
+	Path string
+	Line int
+	Rule string
+}
+
+// String formats the finding as path:line, without the secret itself.
+func (f SecretFinding) String() string {
+	return fmt.Sprintf("%s:%d: %s", f.Path, f.Line, f.Rule)
+}
+
+// allowlistLine is a single line of the files matching pattern that is not scanned.
+type allowlistLine struct {
+	pattern *regexp.Regexp
+	line    int
+}
+
+// secretAllowlist holds the entries of a secret_allowlist file.
+type secretAllowlist struct {
+	paths   []*regexp.Regexp // files that are not scanned
+	lines   []allowlistLine
+	matches []*regexp.Regexp // findings whose text matches are ignored
+}
+
+// SecretScanner looks for credentials in file contents.
+type SecretScanner struct {
+	rules []secretRule
+	allow secretAllowlist
+}
+
+// NewSecretScanner creates a scanner with the built-in rules and the patterns, one regular
+// expression per line. allowlist is the content of a secret_allowlist file: each line is a
+// CODEOWNERS style path pattern of files to skip, a pattern followed by :line to skip a
+// single line, or match: and a regular expression for findings to ignore, such as example keys.
+func NewSecretScanner(patterns string, allowlist []byte) (*SecretScanner, error) {
+	scanner := &SecretScanner{rules: append([]secretRule(nil), builtinSecretRules...)}
+	for number, line := range strings.Split(patterns, "\n") {
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret_patterns line %d: %w", number+1, err)
+		}
+		scanner.rules = append(scanner.rules, secretRule{name: "custom-pattern-" + strconv.Itoa(number+1), pattern: pattern})
+	}
+
+	for number, line := range strings.Split(string(allowlist), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if expr, ok := strings.CutPrefix(line, "match:"); ok {
+			pattern, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid secret allowlist line %d: %w", number+1, err)
+			}
+			scanner.allow.matches = append(scanner.allow.matches, pattern)
+			continue
+		}
+		lineNumber := 0
+		if i := strings.LastIndex(line, ":"); i > 0 {
+			if n, err := strconv.Atoi(line[i+1:]); err == nil && n > 0 {
+				line, lineNumber = line[:i], n
+			}
+		}
+		pattern, err := codeownersPattern(line)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret allowlist line %d: %w", number+1, err)
+		}
+		if lineNumber == 0 {
+			scanner.allow.paths = append(scanner.allow.paths, pattern)
+		} else {
+			scanner.allow.lines = append(scanner.allow.lines, allowlistLine{pattern: pattern, line: lineNumber})
+		}
+	}
+	return scanner, nil
+}
+
+// newConfiguredSecretScanner creates the scanner for the secret_patterns and secret_allowlist
+// inputs, or returns nil when the scan is off.
+func newConfiguredSecretScanner(mode SecretScanMode) (*SecretScanner, error) {
+	if mode == SecretScanOff {
+		return nil, nil
+	}
+	var allowlist []byte
+	if envVar.Input.SecretAllowlist != "" {
+		var err error
+		allowlist, err = ReadFile(envVar.Input.SecretAllowlist)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret_allowlist: %w", err)
+		}
+	}
+	return NewSecretScanner(envVar.Input.SecretPatterns, allowlist)
+}
+
+// scanFile scans the content a change writes. Symbolic links are skipped, and files
+// stored in Git LFS are scanned when their object content is at hand.
+func scanFile(scanner *SecretScanner, file FileChange) []SecretFinding {
+	if file.GitMode() == gitModeSymlink {
+		return nil
+	}
+	content := file.Content
+	if file.lfs != nil {
+		content = file.lfs.content
+	}
+	return scanner.Scan(file.Path, content)
+}
+
+// Scan returns the findings in content, the file at path. Binary files are not scanned.
+func (s *SecretScanner) Scan(path string, content []byte) []SecretFinding {
+	if IsBinary(content) || s.allowedPath(path) {
+		return nil
+	}
+	var findings []SecretFinding
+	for number, line := range strings.Split(string(content), "\n") {
+		if s.allowedLine(path, number+1) {
+			continue
+		}
+		if rule := s.matchLine(line); rule != "" {
+			findings = append(findings, SecretFinding{Path: path, Line: number + 1, Rule: rule})
+		}
+	}
+	return findings
+}
+
+// matchLine returns the rule the line violates, or an empty string when it looks clean.
+func (s *SecretScanner) matchLine(line string) string {
+	for _, rule := range s.rules {
+		for _, match := range rule.pattern.FindAllString(line, -1) {
+			if !s.allowedMatch(match) {
+				return rule.name
+			}
+		}
+	}
+	for _, token := range highEntropyToken.FindAllString(line, -1) {
+		if isHighEntropy(token) && !s.allowedMatch(token) {
+			return highEntropyRule
+		}
+	}
+	return ""
+}
+
+// allowedPath reports whether the allowlist skips the whole file.
+func (s *SecretScanner) allowedPath(path string) bool {
+	for _, pattern := range s.allow.paths {
+		if pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedLine reports whether the allowlist skips a single line of the file.
+func (s *SecretScanner) allowedLine(path string, line int) bool {
+	for _, allowed := range s.allow.lines {
+		if allowed.line == line && allowed.pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowedMatch reports whether the allowlist ignores the matched text.
+func (s *SecretScanner) allowedMatch(match string) bool {
+	for _, pattern := range s.allow.matches {
+		if pattern.MatchString(match) {
+			return true
+		}
+	}
+	return false
+}
+
+// isHighEntropy reports whether token looks random: it mixes letters and digits and its
+// Shannon entropy is above highEntropyThreshold.
+func isHighEntropy(token string) bool {
+	token = strings.TrimRight(token, "=")
+	if len(token) < highEntropyMinLength || !strings.ContainsAny(token, "0123456789") {
+		return false
+	}
+	if strings.ToLower(token) == token || strings.ToUpper(token) == token {
+		// Hex digests, identifiers and constants use a single case
+		return false
+	}
+	counts := make(map[rune]int)
+	for _, r := range token {
+		counts[r]++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(len(token))
+		entropy -= p * math.Log2(p)
+	}
+	return entropy > highEntropyThreshold
+}
+
+// FormatSecrets renders the findings for the plan output.
+func FormatSecrets(mode SecretScanMode, findings []SecretFinding) []string {
+	if len(findings) == 0 {
+		return nil
+	}
+	lines := []string{"Possible secrets found, the files are pushed anyway:"}
+	if mode == SecretScanBlock {
+		lines[0] = "Possible secrets found, nothing is pushed:"
+	}
+	for _, finding := range findings {
+		lines = append(lines, "  "+finding.String())
+	}
+	return lines
+}
@@ -0,0 +1,384 @@
+package gitcopy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Git file modes of tree entries.
+const (
+	gitModeFile       = "100644"
+	gitModeExecutable = "100755"
+	gitModeSymlink    = "120000"
+)
+
+// SymlinkPolicy decides how symbolic links in a source directory are copied.
+type SymlinkPolicy string
+
+const (
+	// SymlinkFollow copies the file or directory a link points to.
+	SymlinkFollow SymlinkPolicy = "follow"
+	// SymlinkPreserve commits the link itself, with its target as content.
+	SymlinkPreserve SymlinkPolicy = "preserve-as-link"
+	// SymlinkSkip leaves links out of the copy.
+	SymlinkSkip SymlinkPolicy = "skip"
+)
+
+// ParseSymlinkPolicy validates a symlinks input, defaulting to follow.
+func ParseSymlinkPolicy(value string) (SymlinkPolicy, error) {
+	switch policy := SymlinkPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return SymlinkFollow, nil
+	case SymlinkFollow, SymlinkPreserve, SymlinkSkip:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("invalid symlinks %q: expected follow, preserve-as-link or skip", value)
+	}
+}
+
+// SourceFile is a file found in a source directory.
+type SourceFile struct {
+	Path string
+	Mode string // git file mode, empty when the file system does not record the executable bit
+	Link string // target of a symbolic link preserved as a link
+	Size int64  // size in bytes, 0 when unknown
+
+	target string // path of the indexed entry holding the content, for files listed from an index
+}
+
+// ReadSourceDir recursively lists the files of a directory with their git file modes,
+// handling symbolic links according to symlinks. Unreadable subdirectories are logged
+// and skipped, as are followed links that lead back into a directory being read.
+func ReadSourceDir(root string, symlinks SymlinkPolicy) ([]SourceFile, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		realRoot = root
+	}
+	return readSourceDir(root, symlinks, map[string]bool{realRoot: true})
+}
+
+// readSourceDir lists dir, whose resolved path and those of its parents are in ancestors.
+func readSourceDir(dir string, symlinks SymlinkPolicy, ancestors map[string]bool) ([]SourceFile, error) {
+	var files []SourceFile
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return files, err
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		isLink := entry.Type()&os.ModeSymlink != 0
+		if isLink && symlinks == SymlinkSkip {
+			log.Printf("INFO: skipping symbolic link %s", path)
+			continue
+		}
+		if isLink && symlinks == SymlinkPreserve {
+			target, err := os.Readlink(path)
+			if err != nil {
+				log.Printf("ERROR: reading symbolic link %s: %v", path, err)
+				continue
+			}
+			if filepath.IsAbs(target) {
+				log.Printf("WARNING: symbolic link %s points to the absolute path %s, which is unlikely to exist in the destination", path, target)
+			}
+			files = append(files, SourceFile{Path: path, Mode: gitModeSymlink, Link: filepath.ToSlash(target)})
+			continue
+		}
+
+		isDir := entry.IsDir()
+		if isLink {
+			info, err := os.Stat(path)
+			if err != nil {
+				log.Printf("WARNING: skipping symbolic link %s: %v", path, err)
+				continue
+			}
+			isDir = info.IsDir()
+		}
+		if !isDir {
+			// A file that cannot be inspected is still listed, reading it reports the error
+			file := SourceFile{Path: path}
+			if info, err := os.Stat(path); err == nil {
+				file.Mode, file.Size = gitFileMode(info), info.Size()
+			}
+			files = append(files, file)
+			continue
+		}
+
+		realPath, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			log.Printf("ERROR: resolving directory %s: %v", path, err)
+			continue
+		}
+		if ancestors[realPath] {
+			log.Printf("WARNING: skipping symbolic link %s: it leads back to %s", path, realPath)
+			continue
+		}
+		ancestors[realPath] = true
+		nestedFiles, err := readSourceDir(path, symlinks, ancestors)
+		delete(ancestors, realPath)
+		if err != nil {
+			log.Printf("ERROR: reading directory %s: %v", path, err)
+			continue
+		}
+		files = append(files, nestedFiles...)
+	}
+	return files, nil
+}
+
+// sourceFileMode returns the git file mode of a single source file.
+func sourceFileMode(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	return gitFileMode(info), nil
+}
+
+// gitFileMode maps the permissions of a file to the git file mode. Windows has no
+// executable bit, so the mode is left empty there and the destination mode is kept.
+func gitFileMode(info os.FileInfo) string {
+	if runtime.GOOS == "windows" {
+		return ""
+	}
+	if info.Mode().Perm()&0o111 != 0 {
+		return gitModeExecutable
+	}
+	return gitModeFile
+}
+
+// SourceRevision identifies the version of the source the files are copied from.
+type SourceRevision struct {
+	Repo   string // owner/name of the source repository, empty when unknown
+	Commit string // commit SHA, empty when unknown
+	Ref    string
+	Remote bool // whether the files are read through the API instead of the runner's file system
+	// Archive is the path or URL of the archive the files are read from, empty otherwise
+	Archive string
+}
+
+// String describes the revision for logs and the plan output.
+func (r SourceRevision) String() string {
+	switch {
+	case r.Archive != "":
+		return "archive " + r.Archive
+	case r.Commit == "":
+		return r.Repo
+	default:
+		return fmt.Sprintf("%s@%s (%s)", r.Repo, r.Ref, shortSha(r.Commit))
+	}
+}
+
+// RepoPath returns the path of a source file in the source repository, empty when the
+// file is not part of it, as for archives. Remote paths already are repository paths;
+// local files are made relative to the git work tree that contains them.
+func (r SourceRevision) RepoPath(source string) string {
+	switch {
+	case r.Archive != "":
+		return ""
+	case r.Remote:
+		return treePath(source)
+	}
+	abs, err := filepath.Abs(source)
+	if err != nil {
+		return ""
+	}
+	for dir := filepath.Dir(abs); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			rel, err := filepath.Rel(dir, abs)
+			if err != nil {
+				return ""
+			}
+			return filepath.ToSlash(rel)
+		}
+		if filepath.Dir(dir) == dir {
+			return ""
+		}
+	}
+}
+
+// fileSource reads the files to copy.
+type fileSource interface {
+	// readFile returns the content and git file mode of a single file.
+	readFile(path string) ([]byte, string, error)
+	// listDir recursively lists the files of a directory.
+	listDir(dir string) ([]SourceFile, error)
+	// dirPath returns dir as the listed paths of its files start.
+	dirPath(dir string) string
+	// read returns the content of a listed file.
+	read(file SourceFile) ([]byte, error)
+}
+
+// localSource reads the files from the runner's file system, usually a checkout of the workflow repository.
+type localSource struct {
+	symlinks SymlinkPolicy
+}
+
+func (s *localSource) readFile(path string) ([]byte, string, error) {
+	content, err := ReadFile(path)
+	if err != nil {
+		return nil, "", err
+	}
+	mode, err := sourceFileMode(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return content, mode, nil
+}
+
+func (s *localSource) listDir(dir string) ([]SourceFile, error) {
+	return ReadSourceDir(dir, s.symlinks)
+}
+
+func (s *localSource) dirPath(dir string) string {
+	return dir
+}
+
+func (s *localSource) read(file SourceFile) ([]byte, error) {
+	if file.Mode == gitModeSymlink {
+		return []byte(file.Link), nil
+	}
+	return ReadFile(file.Path)
+}
+
+// maxSymlinkHops bounds how many links are followed to resolve one path, as git does.
+const maxSymlinkHops = 40
+
+// treeEntry is a file of a source held as a path index.
+type treeEntry struct {
+	Mode    string
+	Sha     string // blob SHA when the content is fetched on demand
+	Content []byte // content when it is held in memory
+	Size    int64  // size of the content fetched on demand, 0 when unknown
+}
+
+// size returns the size of the entry content in bytes, 0 when unknown.
+func (e treeEntry) size() int64 {
+	if e.Content != nil {
+		return int64(len(e.Content))
+	}
+	return e.Size
+}
+
+// treeSource reads the files from an index of the whole source, the recursive tree
+// of a repository or the entries of an archive.
+type treeSource struct {
+	symlinks SymlinkPolicy
+	revision SourceRevision
+	entries  map[string]treeEntry
+	fetch    func(sha string) ([]byte, error) // nil when every entry holds its content
+}
+
+// treePath turns an input path into a path of the source index.
+func treePath(p string) string {
+	p = strings.Trim(path.Clean(filepath.ToSlash(p)), "/")
+	if p == "." {
+		return ""
+	}
+	return p
+}
+
+func (s *treeSource) readFile(p string) ([]byte, string, error) {
+	target, ok, err := s.resolve(treePath(p))
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", fmt.Errorf("%s not found in %s", p, s.revision)
+	}
+	content, err := s.content(s.entries[target])
+	if err != nil {
+		return nil, "", err
+	}
+	return content, s.entries[target].Mode, nil
+}
+
+func (s *treeSource) dirPath(dir string) string {
+	return treePath(dir)
+}
+
+func (s *treeSource) listDir(dir string) ([]SourceFile, error) {
+	prefix := treePath(dir)
+	if prefix != "" {
+		prefix += "/"
+	}
+	var files []SourceFile
+	for p, entry := range s.entries {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+		if entry.Mode != gitModeSymlink {
+			files = append(files, SourceFile{Path: p, Mode: entry.Mode, Size: entry.size(), target: p})
+			continue
+		}
+		switch s.symlinks {
+		case SymlinkSkip:
+			log.Printf("INFO: skipping symbolic link %s", p)
+		case SymlinkPreserve:
+			link, err := s.content(entry)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, SourceFile{Path: p, Mode: gitModeSymlink, Link: string(link)})
+		default:
+			target, ok, err := s.resolve(p)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				// Links to directories are not followed, their files are listed where they live
+				log.Printf("WARNING: skipping symbolic link %s: it does not lead to a file in %s", p, s.revision)
+				continue
+			}
+			files = append(files, SourceFile{Path: p, Mode: s.entries[target].Mode, Size: s.entries[target].size(), target: target})
+		}
+	}
+	if len(files) == 0 && prefix != "" {
+		return nil, fmt.Errorf("directory %s not found in %s", dir, s.revision)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func (s *treeSource) read(file SourceFile) ([]byte, error) {
+	if file.Mode == gitModeSymlink {
+		return []byte(file.Link), nil
+	}
+	return s.content(s.entries[file.target])
+}
+
+// resolve follows symbolic links from p to the path of the file they lead to. It reports
+// false when p does not exist or a link leads outside the source, to a directory or in a cycle.
+func (s *treeSource) resolve(p string) (string, bool, error) {
+	for hops := 0; hops < maxSymlinkHops; hops++ {
+		entry, ok := s.entries[p]
+		if !ok || entry.Mode != gitModeSymlink {
+			return p, ok, nil
+		}
+		target, err := s.content(entry)
+		if err != nil {
+			return "", false, err
+		}
+		if path.IsAbs(string(target)) {
+			return "", false, nil
+		}
+		p = path.Join(path.Dir(p), string(target))
+		if p == ".." || strings.HasPrefix(p, "../") {
+			return "", false, nil
+		}
+	}
+	return "", false, nil
+}
+
+// content returns the content of an entry, fetching it when it is not held in memory.
+func (s *treeSource) content(entry treeEntry) ([]byte, error) {
+	if entry.Content != nil || s.fetch == nil {
+		return entry.Content, nil
+	}
+	return s.fetch(entry.Sha)
+}
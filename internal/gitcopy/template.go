@@ -0,0 +1,120 @@
+package gitcopy
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// TemplateFile is a changed file as seen by the message templates.
+type TemplateFile struct {
+	Source string // path of the source file
+	Path   string // path in the destination repository
+	Action ChangeAction
+}
+
+// TemplateData is the data available to the pull request and commit message templates.
+type TemplateData struct {
+	SourceRepo  string // owner/name of the source repository
+	Sha         string // source commit SHA
+	ShortSha    string
+	Ref         string // source ref
+	Workflow    string
+	RunId       string
+	RunUrl      string // link to the workflow run, empty outside GitHub Actions
+	Destination string // owner/name of the destination repository
+	BaseBranch  string
+	Branch      string
+	Files       []TemplateFile // files changed by the pull request or commit
+
+	// Only set for pr_body_template
+	Description string // pull_description input
+	Summary     string // generated summary of the copy, merges, conflicts and excluded files
+	Diffs       string // collapsible diff sections, already cut to fit the body
+}
+
+// messageTemplates holds the parsed templates. Each is nil when not configured.
+type messageTemplates struct {
+	title  *template.Template
+	body   *template.Template
+	commit *template.Template
+}
+
+// parseTemplates parses the pr_title_template, pr_body_template and
+// commit_message_template inputs so that errors surface before anything is written.
+func parseTemplates(plan *Plan) (*messageTemplates, error) {
+	// Templates are only rendered when files are written, so without changes a
+	// placeholder file stands in for them
+	sample := newTemplateData(plan, plan.Changes())
+	if len(sample.Files) == 0 {
+		sample.Files = []TemplateFile{{Source: "source", Path: "path", Action: ActionCreate}}
+	}
+	var templates messageTemplates
+	for _, t := range []struct {
+		name  string
+		value string
+		dest  **template.Template
+	}{
+		{"pr_title_template", envVar.Input.PrTitleTemplate, &templates.title},
+		{"pr_body_template", envVar.Input.PrBodyTemplate, &templates.body},
+		{"commit_message_template", envVar.Input.CommitMessageTemplate, &templates.commit},
+	} {
+		if t.value == "" {
+			continue
+		}
+		parsed, err := template.New(t.name).Option("missingkey=error").Funcs(template.FuncMap{
+			"join": strings.Join,
+		}).Parse(t.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", t.name, err)
+		}
+		// Executing once with the data of this run catches references to unknown fields
+		if err := parsed.Execute(io.Discard, sample); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", t.name, err)
+		}
+		*t.dest = parsed
+	}
+	return &templates, nil
+}
+
+// render executes t with data, returning fallback when t is nil.
+func render(t *template.Template, data TemplateData, fallback string) (string, error) {
+	if t == nil {
+		return fallback, nil
+	}
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", t.Name(), err)
+	}
+	return out.String(), nil
+}
+
+// newTemplateData describes the source run and the given changes.
+func newTemplateData(plan *Plan, files []FileChange) TemplateData {
+	data := TemplateData{
+		SourceRepo:  plan.Source.Repo,
+		Sha:         plan.Source.Commit,
+		ShortSha:    shortSha(plan.Source.Commit),
+		Ref:         plan.Source.Ref,
+		Workflow:    envVar.GitHub.Workflow,
+		RunId:       envVar.GitHub.RunId,
+		RunUrl:      runUrl(),
+		Destination: envVar.Input.Owner + "/" + envVar.Input.Repo,
+		BaseBranch:  plan.BaseBranch,
+		Branch:      plan.Branch,
+	}
+	for _, file := range files {
+		data.Files = append(data.Files, TemplateFile{Source: file.Source, Path: file.Path, Action: file.Action})
+	}
+	return data
+}
+
+// runUrl links to the workflow run that performs the copy, or is empty when
+// the run is unknown.
+func runUrl() string {
+	if envVar.GitHub.Server == "" || envVar.GitHub.Repo == "" || envVar.GitHub.RunId == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/actions/runs/%s", strings.TrimSuffix(envVar.GitHub.Server, "/"), envVar.GitHub.Repo, envVar.GitHub.RunId)
+}
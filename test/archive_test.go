@@ -0,0 +1,163 @@
+package cmd_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// archiveEntry is a file or symbolic link of a test archive
+type archiveEntry struct {
+	name    string
+	content string
+	mode    int64
+	link    string
+}
+
+// tarGz builds a gzipped tarball of entries
+func tarGz(t *testing.T, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Mode: entry.mode, Size: int64(len(entry.content)), Typeflag: tar.TypeReg}
+		if entry.link != "" {
+			header = &tar.Header{Name: entry.name, Mode: 0o777, Linkname: entry.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// TestApplyArchiveURL tests copying a directory of a tarball downloaded from a URL
+func TestApplyArchiveURL(t *testing.T) {
+	archive := tarGz(t, []archiveEntry{
+		{name: "sdk/client.go", content: "package sdk\n", mode: 0o644},
+		{name: "sdk/bin/generate.sh", content: "#!/bin/sh\n", mode: 0o755},
+		{name: "sdk/current.go", link: "client.go"},
+		{name: "../outside.txt", content: "escape\n", mode: 0o644},
+		{name: "README.md", content: "readme\n", mode: 0o644},
+	})
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if r.URL.Path != "/artifacts/sdk.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(archive)
+	}))
+	defer server.Close()
+
+	fake := newFakeGitHub(t, nil)
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.SourceArchive = server.URL + "/artifacts/sdk.tar.gz"
+		env.Input.Directory = "sdk"
+		env.Input.DestinationDirectory = "vendor/sdk"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "source archive "+server.URL+"/artifacts/sdk.tar.gz") {
+		t.Errorf("Expected the archive in the plan output:\n%s", out.String())
+	}
+	if authorization != "" {
+		t.Error("the token must not be sent to hosts other than the GitHub API")
+	}
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	want := map[string]string{
+		"vendor/sdk/client.go":       "package sdk\n",
+		"vendor/sdk/current.go":      "package sdk\n",
+		"vendor/sdk/bin/generate.sh": "#!/bin/sh\n",
+	}
+	for path, content := range want {
+		if got, _ := fake.file("copy-branch", path); got != content {
+			t.Errorf("Expected %s to be %q, got %q", path, content, got)
+		}
+	}
+	if mode := fake.mode("copy-branch", "vendor/sdk/bin/generate.sh"); mode != "100755" {
+		t.Errorf("Expected generate.sh to keep mode 100755, got %q", mode)
+	}
+	if fake.commitCount("copy-branch") != 1 {
+		t.Errorf("Expected a single commit, got %d", fake.commitCount("copy-branch"))
+	}
+
+	env := gitcopy.GetEnvironment()
+	env.Input.Directory = "/sdk/"
+	gitcopy.SetEnvironment(env)
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan of /sdk/ failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "vendor/sdk/bin/generate.sh <- sdk/bin/generate.sh") {
+		t.Errorf("Expected a rooted directory to list the archive files:\n%s", out.String())
+	}
+}
+
+// TestApplyArchiveZip tests copying a single file out of a local zip archive
+func TestApplyArchiveZip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("docs/index.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("# Docs\n"))
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	archive := filepath.Join(t.TempDir(), "docs.zip")
+	if err := os.WriteFile(archive, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeGitHub(t, nil)
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.SourceArchive = archive
+		env.Input.FilePath = "docs/index.md"
+		env.Input.DestinationFilePath = "site/index.md"
+	})
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if content, _ := fake.file("copy-branch", "site/index.md"); content != "# Docs\n" {
+		t.Errorf("Expected site/index.md from the archive, got %q", content)
+	}
+
+	notArchive := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(notArchive, []byte("plain text"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	env := gitcopy.GetEnvironment()
+	env.Input.SourceArchive = notArchive
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandPlan, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("Expected unsupported archive error, got %v", err)
+	}
+}
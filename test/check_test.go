@@ -0,0 +1,143 @@
+package cmd_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestApplyCheckMode tests that check mode reports drift without writing and keeps a single tracking issue
+func TestApplyCheckMode(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{
+		"docs/guide.md": "old guide\n",
+		"docs/intro.md": "intro\n",
+	})
+	source := writeSourceDir(t, map[string]string{
+		"guide.md": "new guide\n",
+		"intro.md": "intro\n",
+		"setup.md": "setup\n",
+	})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Mode = "check"
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "docs"
+	})
+	head := fake.refs["master"]
+
+	var out bytes.Buffer
+	err := gitcopy.Run(gitcopy.CommandApply, &out)
+	if !errors.Is(err, gitcopy.ErrDrift) {
+		t.Fatalf("Expected ErrDrift, got %v", err)
+	}
+	for _, want := range []string{"out of sync: 2 file(s) differ on master\n", "  update    docs/guide.md\n", "  create    docs/setup.md\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("check output missing %q:\n%s", want, out.String())
+		}
+	}
+	if fake.refs["master"] != head || len(fake.refs) != 1 || len(fake.issues) != 0 {
+		t.Error("check mode must not write to the destination or open an issue without drift_issue")
+	}
+
+	env := gitcopy.GetEnvironment()
+	env.Input.DriftIssue = "true"
+	gitcopy.SetEnvironment(env)
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); !errors.Is(err, gitcopy.ErrDrift) {
+		t.Fatalf("Expected ErrDrift, got %v", err)
+	}
+	if len(fake.issues) != 1 {
+		t.Fatalf("Expected one tracking issue, got %d", len(fake.issues))
+	}
+	issue := fake.issues[1000]
+	if issue.Title != "Files out of sync with source/repo" || !strings.Contains(out.String(), "tracking issue #1000 created\n") {
+		t.Errorf("Unexpected issue title %q or output:\n%s", issue.Title, out.String())
+	}
+	for _, want := range []string{"| `docs/guide.md` | update | +1 -1 |", "| `docs/setup.md` | create | +1 -0 |", "+new guide"} {
+		if !strings.Contains(issue.Body, want) {
+			t.Errorf("issue body missing %q:\n%s", want, issue.Body)
+		}
+	}
+	if strings.Contains(issue.Body, "docs/intro.md") {
+		t.Errorf("Expected unchanged files to be left out of the issue:\n%s", issue.Body)
+	}
+
+	// The same destination written differently still finds the issue
+	env.Input.DriftIssueTitle = "Docs drifted"
+	env.Input.DestinationDirectory = "./docs/"
+	gitcopy.SetEnvironment(env)
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); !errors.Is(err, gitcopy.ErrDrift) {
+		t.Fatalf("Expected ErrDrift, got %v", err)
+	}
+	if len(fake.issues) != 1 || issue.Title != "Docs drifted" || !strings.Contains(out.String(), "tracking issue #1000 updated\n") {
+		t.Errorf("Expected the tracking issue to be updated, got %d issue(s) titled %q:\n%s", len(fake.issues), issue.Title, out.String())
+	}
+
+	env.Input.Directory = writeSourceDir(t, map[string]string{
+		"guide.md": "old guide\n",
+		"intro.md": "intro\n",
+	})
+	gitcopy.SetEnvironment(env)
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+		t.Fatalf("check failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "in sync: master matches the source\ntracking issue #1000 closed\n") {
+		t.Errorf("Expected the issue to be closed:\n%s", out.String())
+	}
+	if issue.State != "closed" || len(issue.Comments) != 1 {
+		t.Errorf("Expected the issue to be closed with a comment, got %s with %d comment(s)", issue.State, len(issue.Comments))
+	}
+
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil || strings.Contains(out.String(), "tracking issue") {
+		t.Errorf("Expected a closed issue to be left alone, got %v:\n%s", err, out.String())
+	}
+
+	env.Input.Mode = "audit"
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandPlan, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "expected pr, direct or check") {
+		t.Errorf("Expected invalid mode error, got %v", err)
+	}
+}
+
+// TestApplyCheckModeLargeDrift tests that the tracking issue of a large drift stays within GitHub's body size limit
+func TestApplyCheckModeLargeDrift(t *testing.T) {
+	fake := newFakeGitHub(t, nil)
+	files := make(map[string]string, 250)
+	for i := range 250 {
+		files[fmt.Sprintf("%03d.yaml", i)] = strings.Repeat(fmt.Sprintf("setting-%d: value\n", i), 100)
+	}
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Mode = "check"
+		env.Input.Directory = writeSourceDir(t, files)
+		env.Input.DestinationDirectory = "config"
+		env.Input.DriftIssue = "true"
+	})
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); !errors.Is(err, gitcopy.ErrDrift) {
+		t.Fatalf("Expected ErrDrift, got %v", err)
+	}
+	issue := fake.issues[1000]
+	if issue == nil {
+		t.Fatal("Expected a tracking issue")
+	}
+	if len(issue.Body) > 65536 {
+		t.Errorf("Expected the issue body within 65536 characters, got %d", len(issue.Body))
+	}
+	if rows := strings.Count(issue.Body, " | create | "); rows != 200 {
+		t.Errorf("Expected 200 listed files, got %d", rows)
+	}
+	for _, want := range []string{"| `config/199.yaml` | create |", "...and 50 more file(s) not listed", "more changed file(s) not shown"} {
+		if !strings.Contains(issue.Body, want) {
+			t.Errorf("issue body missing %q", want)
+		}
+	}
+	if strings.Contains(issue.Body, "config/200.yaml") {
+		t.Error("Expected files past the table limit to be left out of the issue")
+	}
+}
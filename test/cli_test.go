@@ -0,0 +1,144 @@
+package cmd_test
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// clearConfigEnv blanks every variable LoadEnvironment reads so the host environment does not leak into tests
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"GIT_COPY_CONFIG", "GITHUB_TOKEN", "GITHUB_API_URL", "GITHUB_REPOSITORY", "GITHUB_WORKFLOW", "GITHUB_REF",
+		"GITHUB_SHA", "GITHUB_RUN_ID", "GITHUB_JOB", "GITHUB_SERVER_URL", "INPUT_OWNER", "INPUT_REPO",
+		"INPUT_FILE_PATH", "INPUT_DESTINATION_FILE_PATH", "INPUT_DIRECTORY", "INPUT_DESTINATION_DIRECTORY",
+		"INPUT_PULL_MESSAGE", "INPUT_PULL_DESCRIPTION", "INPUT_REVIEWERS", "INPUT_TEAM_REVIEWERS",
+		"INPUT_REF_BRANCH", "INPUT_BRANCH", "INPUT_ON_CONFLICT", "INPUT_LOCK_FILE", "INPUT_MERGE",
+		"INPUT_MERGE_CONFLICTS", "INPUT_LABELS", "INPUT_ASSIGNEES", "INPUT_MILESTONE", "INPUT_DRAFT",
+		"INPUT_AUTO_MERGE", "INPUT_MODE", "INPUT_DRIFT_ISSUE", "INPUT_DRIFT_ISSUE_TITLE",
+		"INPUT_CODEOWNERS_REVIEWERS",
+		"INPUT_PR_TITLE_TEMPLATE", "INPUT_PR_BODY_TEMPLATE", "INPUT_COMMIT_MESSAGE_TEMPLATE",
+		"INPUT_COMMIT_TYPE", "INPUT_COMMIT_SCOPE", "INPUT_COMMIT_SIGNOFF", "INPUT_COMMIT_CO_AUTHOR",
+		"INPUT_COMMIT_AUTHOR_NAME", "INPUT_COMMIT_AUTHOR_EMAIL", "INPUT_COMMIT_AUTHOR_FROM_SOURCE", "INPUT_COMMITTER_NAME",
+		"INPUT_COMMITTER_EMAIL", "INPUT_SIGNING_KEY", "INPUT_SIGNING_PASSPHRASE", "INPUT_SYMLINKS",
+		"INPUT_RENAME", "INPUT_FLATTEN", "INPUT_ALLOWED_DESTINATION_PATHS",
+		"INPUT_SECRET_SCAN", "INPUT_SECRET_PATTERNS", "INPUT_SECRET_ALLOWLIST",
+		"INPUT_MAX_FILE_SIZE", "INPUT_MAX_TOTAL_SIZE", "INPUT_SKIP_BINARY", "INPUT_NORMALIZE",
+		"INPUT_SOURCE_OWNER", "INPUT_SOURCE_REPO", "INPUT_SOURCE_REF", "INPUT_SOURCE_ARCHIVE",
+	} {
+		t.Setenv(key, "")
+	}
+	originalEnv := gitcopy.GetEnvironment()
+	t.Cleanup(func() { gitcopy.SetEnvironment(originalEnv) })
+}
+
+// TestLoadEnvironmentFlags tests configuration from command line flags only
+func TestLoadEnvironmentFlags(t *testing.T) {
+	clearConfigEnv(t)
+
+	err := gitcopy.LoadEnvironment([]string{
+		"--token", "flag-token",
+		"--owner", "test-owner",
+		"--repo", "test-repo",
+		"--file-path", "README.md",
+		"--destination-file-path", "docs/README.md",
+	})
+	if err != nil {
+		t.Fatalf("LoadEnvironment failed: %v", err)
+	}
+
+	env := gitcopy.GetEnvironment()
+	if env.GitHub.Token != "flag-token" {
+		t.Errorf("Expected token 'flag-token', got '%s'", env.GitHub.Token)
+	}
+	if env.Input.DestinationFilePath != "docs/README.md" {
+		t.Errorf("Expected destination 'docs/README.md', got '%s'", env.Input.DestinationFilePath)
+	}
+	if env.Input.RefBranch != "master" {
+		t.Errorf("Expected default ref branch 'master', got '%s'", env.Input.RefBranch)
+	}
+	if env.GitHub.Api != "https://api.github.com" {
+		t.Errorf("Expected default API URL, got '%s'", env.GitHub.Api)
+	}
+	if env.GitHub.Workflow != "" || env.GitHub.RunId != "" {
+		t.Errorf("CI context should be optional and empty, got workflow '%s' run '%s'", env.GitHub.Workflow, env.GitHub.RunId)
+	}
+}
+
+// TestLoadEnvironmentPrecedence tests that flags win over env vars, which win over the config file
+func TestLoadEnvironmentPrecedence(t *testing.T) {
+	clearConfigEnv(t)
+
+	configFile := filepath.Join(t.TempDir(), "git-copy.json")
+	config := `{
+		"token": "config-token",
+		"owner": "config-owner",
+		"repo": "config-repo",
+		"ref_branch": "main",
+		"reviewers": ["alice", "bob"]
+	}`
+	if err := os.WriteFile(configFile, []byte(config), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	t.Setenv("INPUT_OWNER", "env-owner")
+	t.Setenv("INPUT_REPO", "env-repo")
+
+	err := gitcopy.LoadEnvironment([]string{"--config", configFile, "--repo", "flag-repo"})
+	if err != nil {
+		t.Fatalf("LoadEnvironment failed: %v", err)
+	}
+
+	env := gitcopy.GetEnvironment()
+	if env.Input.Repo != "flag-repo" {
+		t.Errorf("Expected flag to win, got repo '%s'", env.Input.Repo)
+	}
+	if env.Input.Owner != "env-owner" {
+		t.Errorf("Expected env var to win over config, got owner '%s'", env.Input.Owner)
+	}
+	if env.GitHub.Token != "config-token" {
+		t.Errorf("Expected token from config, got '%s'", env.GitHub.Token)
+	}
+	if env.Input.RefBranch != "main" {
+		t.Errorf("Expected ref branch 'main' from config, got '%s'", env.Input.RefBranch)
+	}
+	if env.Input.Reviewers != "alice,bob" {
+		t.Errorf("Expected reviewers 'alice,bob' from config list, got '%s'", env.Input.Reviewers)
+	}
+}
+
+// TestLoadEnvironmentErrors tests missing values, bad config files and help
+func TestLoadEnvironmentErrors(t *testing.T) {
+	clearConfigEnv(t)
+
+	if err := gitcopy.LoadEnvironment([]string{"--owner", "o", "--repo", "r"}); err == nil {
+		t.Error("Expected error for missing token, got nil")
+	}
+
+	if err := gitcopy.LoadEnvironment([]string{"--config", "/non/existent/config.json"}); err == nil {
+		t.Error("Expected error for missing config file, got nil")
+	}
+
+	configFile := filepath.Join(t.TempDir(), "git-copy.json")
+	if err := os.WriteFile(configFile, []byte(`{"token": "t", "owner": "o", "repo": "r", "reviewer": "alice"}`), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	err := gitcopy.LoadEnvironment([]string{"--config", configFile})
+	if err == nil || !strings.Contains(err.Error(), `unknown key "reviewer" in config file `+configFile) {
+		t.Errorf("Expected unknown key error, got %v", err)
+	}
+
+	if err := gitcopy.LoadEnvironment([]string{"--token", "t", "--owner", "o", "--repo", "r", "extra"}); err == nil {
+		t.Error("Expected error for unexpected argument, got nil")
+	}
+
+	err = gitcopy.LoadEnvironment([]string{"--help"})
+	if !errors.Is(err, flag.ErrHelp) {
+		t.Errorf("Expected flag.ErrHelp for --help, got %v", err)
+	}
+}
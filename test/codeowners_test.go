@@ -0,0 +1,78 @@
+package cmd_test
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestCodeownersOwners tests CODEOWNERS pattern matching where the last match wins
+func TestCodeownersOwners(t *testing.T) {
+	codeowners := gitcopy.ParseCodeowners([]byte(`# default owners
+*                   @org/everyone
+*.js                @js-owner    # inline comment
+/build/logs/        @logs-owner
+docs/*              @docs-owner
+apps/               @apps-owner
+**/config/**        @config-owner
+/scripts/           @org/platform user@example.com
+/scripts/generated
+`))
+
+	tests := []struct {
+		path   string
+		owners string
+	}{
+		{"README.md", "@org/everyone"},
+		{"src/app.js", "@js-owner"},
+		{"build/logs/today/run.log", "@logs-owner"},
+		{"other/build/logs/run.log", "@org/everyone"},
+		{"docs/getting-started.md", "@docs-owner"},
+		{"docs/build-app/troubleshooting.md", "@org/everyone"},
+		{"apps/web/index.html", "@apps-owner"},
+		{"nested/apps/web/index.html", "@apps-owner"},
+		{"service/config/deep/values.yaml", "@config-owner"},
+		{"scripts/deploy.sh", "@org/platform user@example.com"},
+		{"scripts/generated/out.sh", ""},
+	}
+	for _, tt := range tests {
+		if got := strings.Join(codeowners.Owners(tt.path), " "); got != tt.owners {
+			t.Errorf("Owners(%q) = %q, expected %q", tt.path, got, tt.owners)
+		}
+	}
+}
+
+// TestApplyCodeownersReviewers tests requesting the destination code owners of the changed files
+func TestApplyCodeownersReviewers(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{
+		".github/CODEOWNERS": "*.md @org/docs-team\nconfig/ @config-owner @copy-bot\nunchanged/ @nobody\n",
+		"unchanged/file.txt": "same\n",
+	})
+	fake.login = "copy-bot"
+	source := writeSourceDir(t, map[string]string{
+		"config/app.json":    "{}\n",
+		"guide.md":           "# Guide\n",
+		"unchanged/file.txt": "same\n",
+	})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "."
+		env.Input.Reviewers = "static-reviewer"
+		env.Input.CodeownersReviewers = "true"
+	})
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	reviewers := fake.reviewers[1]
+	sort.Strings(reviewers)
+	if got := strings.Join(reviewers, ","); got != "config-owner,static-reviewer,team:docs-team" {
+		t.Errorf("unexpected reviewers %q", got)
+	}
+	if _, exists := fake.file("copy-branch", "config/app.json"); !exists {
+		t.Error("Expected config/app.json to be copied")
+	}
+}
@@ -0,0 +1,736 @@
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// writeSourceDir creates a source directory with the given files
+func writeSourceDir(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// TestSplitCommand tests separating the subcommand from the flags
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		command string
+		rest    int
+	}{
+		{nil, gitcopy.CommandApply, 0},
+		{[]string{"--owner", "o"}, gitcopy.CommandApply, 2},
+		{[]string{"plan", "--owner", "o"}, gitcopy.CommandPlan, 2},
+		{[]string{"diff"}, gitcopy.CommandDiff, 0},
+		{[]string{"status"}, gitcopy.CommandStatus, 0},
+		{[]string{"apply", "--repo", "r"}, gitcopy.CommandApply, 2},
+	}
+	for _, tt := range tests {
+		command, rest := gitcopy.SplitCommand(tt.args)
+		if command != tt.command || len(rest) != tt.rest {
+			t.Errorf("SplitCommand(%v) = %q, %v", tt.args, command, rest)
+		}
+	}
+}
+
+// TestUnifiedDiff tests the unified diff output
+func TestUnifiedDiff(t *testing.T) {
+	oldContent := []byte("one\ntwo\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\n")
+	newContent := []byte("one\nTWO\nthree\nfour\nfive\nsix\nseven\neight\nnine\nten\neleven\n")
+
+	got := gitcopy.UnifiedDiff("a/file", "b/file", oldContent, newContent, 1)
+	want := "--- a/file\n+++ b/file\n" +
+		"@@ -1,3 +1,3 @@\n one\n-two\n+TWO\n three\n" +
+		"@@ -10,1 +10,2 @@\n ten\n+eleven\n"
+	if got != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+
+	if diff := gitcopy.UnifiedDiff("a/file", "b/file", oldContent, oldContent, 3); diff != "" {
+		t.Errorf("Expected no diff for equal content, got %q", diff)
+	}
+}
+
+// TestUnifiedDiffEdgeCases tests new files, missing final newlines and binary content
+func TestUnifiedDiffEdgeCases(t *testing.T) {
+	created := gitcopy.UnifiedDiff("/dev/null", "b/new", nil, []byte("a\nb\n"), 3)
+	if !strings.Contains(created, "@@ -0,0 +1,2 @@\n+a\n+b\n") {
+		t.Errorf("unexpected diff for created file:\n%s", created)
+	}
+
+	noNewline := gitcopy.UnifiedDiff("a/f", "b/f", []byte("a\nb"), []byte("a\nc"), 3)
+	if !strings.Contains(noNewline, "-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n") {
+		t.Errorf("unexpected diff without final newline:\n%s", noNewline)
+	}
+
+	binary := gitcopy.UnifiedDiff("a/img", "b/img", []byte{0, 1}, []byte{0, 2}, 3)
+	if binary != "Binary files a/img and b/img differ\n" {
+		t.Errorf("unexpected binary diff: %q", binary)
+	}
+}
+
+// TestUnifiedDiffMinimal tests that diffs of random inputs rebuild both sides with the fewest changed lines
+func TestUnifiedDiffMinimal(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		result := make([]string, random.Intn(30))
+		for i := range result {
+			result[i] = string(rune('a'+random.Intn(4))) + "\n"
+		}
+		return result
+	}
+	for round := 0; round < 500; round++ {
+		a, b := lines(), lines()
+		diff := gitcopy.UnifiedDiff("a/f", "b/f", []byte(strings.Join(a, "")), []byte(strings.Join(b, "")), 100)
+		var oldLines, newLines []string
+		changed := 0
+		for _, line := range strings.SplitAfter(diff, "\n") {
+			switch {
+			case line == "" || strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "+++ ") || strings.HasPrefix(line, "@@"):
+			case line[0] == ' ':
+				oldLines, newLines = append(oldLines, line[1:]), append(newLines, line[1:])
+			case line[0] == '-':
+				oldLines = append(oldLines, line[1:])
+				changed++
+			case line[0] == '+':
+				newLines = append(newLines, line[1:])
+				changed++
+			}
+		}
+		if diff != "" && (strings.Join(oldLines, "") != strings.Join(a, "") || strings.Join(newLines, "") != strings.Join(b, "")) {
+			t.Fatalf("diff does not rebuild the inputs %q and %q:\n%s", a, b, diff)
+		}
+		// The fewest changed lines follow from the longest common subsequence.
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if want := len(a) + len(b) - 2*lcs[0][0]; changed != want {
+			t.Fatalf("diff of %q and %q changes %d line(s), expected %d:\n%s", a, b, changed, want, diff)
+		}
+	}
+}
+
+// TestUnifiedDiffLarge tests that rewritten large files are diffed in bounded memory and huge ones are not diffed
+func TestUnifiedDiffLarge(t *testing.T) {
+	var oldContent, newContent strings.Builder
+	for i := 0; i < 6000; i++ {
+		fmt.Fprintf(&oldContent, "old line %d\n", i)
+		fmt.Fprintf(&newContent, "new line %d\n", i)
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	diff := gitcopy.UnifiedDiff("a/lock", "b/lock", []byte(oldContent.String()), []byte(newContent.String()), 3)
+	runtime.ReadMemStats(&after)
+	if strings.Count(diff, "\n-old line") != 6000 || strings.Count(diff, "\n+new line") != 6000 {
+		t.Errorf("Expected every line to be replaced")
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Errorf("Expected the diff to allocate little, got %d bytes", allocated)
+	}
+
+	huge := []byte(strings.Repeat("line of text\n", 100000))
+	if diff := gitcopy.UnifiedDiff("a/big", "b/big", huge, append(huge, "more\n"...), 3); diff != "Files a/big and b/big differ, diff too large to show\n" {
+		t.Errorf("unexpected diff of a huge file: %q", diff)
+	}
+}
+
+// TestFormatDiffs tests the collapsible diff sections and their size limits
+func TestFormatDiffs(t *testing.T) {
+	small := gitcopy.FileChange{Path: "small.txt", Action: gitcopy.ActionUpdate, Previous: []byte("a\n"), Content: []byte("b\n")}
+	sections := gitcopy.FormatDiffs([]gitcopy.FileChange{small}, 65536)
+	if len(sections) != 1 {
+		t.Fatalf("Expected 1 section, got %d", len(sections))
+	}
+	want := "<details>\n<summary>small.txt (update)</summary>\n\n```diff\n--- a/small.txt\n+++ b/small.txt\n@@ -1,1 +1,1 @@\n-a\n+b\n```\n\n</details>"
+	if sections[0] != want {
+		t.Errorf("unexpected section:\n%s", sections[0])
+	}
+
+	large := gitcopy.FileChange{Path: "large.txt", Action: gitcopy.ActionCreate, Content: []byte(strings.Repeat("line of text\n", 5000))}
+	sections = gitcopy.FormatDiffs([]gitcopy.FileChange{large, small}, 65536)
+	if len(sections[0]) > 20000 || !strings.Contains(sections[0], "more line(s) not shown") {
+		t.Errorf("Expected the large diff to be truncated, got %d bytes", len(sections[0]))
+	}
+
+	sections = gitcopy.FormatDiffs([]gitcopy.FileChange{small, small, small}, 250)
+	if len(sections) != 2 || !strings.HasPrefix(sections[1], "2 more changed file(s) not shown") {
+		t.Errorf("Expected sections past the limit to be counted, got %q", sections)
+	}
+}
+
+// TestPlanAndDiff tests the plan and diff commands against a fake destination repository
+func TestPlanAndDiff(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{
+		"docs/same.txt":    "same\n",
+		"docs/changed.txt": "old\n",
+	})
+	source := writeSourceDir(t, map[string]string{
+		"same.txt":    "same\n",
+		"changed.txt": "new\n",
+		"added.txt":   "added\n",
+	})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "docs"
+	})
+
+	plan, err := gitcopy.BuildPlan()
+	if err != nil {
+		t.Fatalf("BuildPlan failed: %v", err)
+	}
+	if plan.InSync() {
+		t.Error("Expected plan to be out of sync")
+	}
+	if len(plan.Changes()) != 2 {
+		t.Errorf("Expected 2 changes, got %d", len(plan.Changes()))
+	}
+
+	var out bytes.Buffer
+	gitcopy.WritePlan(&out, plan)
+	for _, want := range []string{
+		"create    docs/added.txt",
+		"update    docs/changed.txt",
+		"unchanged docs/same.txt",
+		"1 to create, 1 to update, 1 unchanged, 0 skipped",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	gitcopy.WriteDiff(&out, plan)
+	for _, want := range []string{
+		"--- /dev/null\n+++ b/docs/added.txt\n",
+		"--- a/docs/changed.txt\n+++ b/docs/changed.txt\n@@ -1,1 +1,1 @@\n-old\n+new\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("diff output missing %q:\n%s", want, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "same.txt") {
+		t.Errorf("diff should not include unchanged files:\n%s", out.String())
+	}
+
+	if _, exists := fake.file("copy-branch", "docs/added.txt"); exists {
+		t.Error("plan must not write to the destination")
+	}
+}
+
+// TestApplyAndStatus tests that apply opens a pull request and status reports it
+func TestApplyAndStatus(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{"README.md": "old readme\n"})
+	source := writeSourceDir(t, map[string]string{"README.md": "new readme\n"})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.FilePath = filepath.Join(source, "README.md")
+		env.Input.DestinationFilePath = "README.md"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "pull request #1 created") {
+		t.Errorf("unexpected apply output:\n%s", out.String())
+	}
+	if content, _ := fake.file("copy-branch", "README.md"); content != "new readme\n" {
+		t.Errorf("Expected README.md to be updated on the copy branch, got %q", content)
+	}
+	if content, _ := fake.file("master", "README.md"); content != "old readme\n" {
+		t.Errorf("apply must not change the base branch, got %q", content)
+	}
+	body := fake.pulls[0].Body
+	if !strings.Contains(body, "<summary>README.md (update)</summary>") || !strings.Contains(body, "-old readme\n+new readme\n") {
+		t.Errorf("Expected the diff in the pull request body, got:\n%s", body)
+	}
+	if strings.Count(body, "file "+filepath.Join(source, "README.md")+" updated to README.md") != 1 {
+		t.Errorf("Expected a single update line in the pull request body, got:\n%s", body)
+	}
+
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandStatus, &out); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	for _, want := range []string{"in sync: copy-branch", "open pull request #1 from copy-branch"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("status output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(source, "README.md"), []byte("newer readme\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if len(fake.pulls) != 1 || !strings.Contains(fake.pulls[0].Body, "-new readme\n+newer readme\n") {
+		t.Errorf("Expected the open pull request to show the latest changes, got:\n%s", fake.pulls[0].Body)
+	}
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if !strings.Contains(fake.pulls[0].Body, "+newer readme\n") {
+		t.Errorf("Expected a run without changes to keep the description, got:\n%s", fake.pulls[0].Body)
+	}
+}
+
+// TestApplySingleCommit tests that the file, the directory and the lockfile are written in one
+// commit, and that a failed commit leaves the branch untouched
+func TestApplySingleCommit(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{"docs/a.md": "old\n"})
+	source := writeSourceDir(t, map[string]string{".git/HEAD": "ref: refs/heads/main\n", "README.md": "readme\n", "docs/a.md": "new\n", "docs/b.md": "b\n"})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.FilePath = filepath.Join(source, "README.md")
+		env.Input.DestinationFilePath = "README.md"
+		env.Input.Directory = filepath.Join(source, "docs")
+		env.Input.DestinationDirectory = "docs"
+		env.Input.LockFile = ".git-copy.lock"
+	})
+
+	fake.failTrees = true
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err == nil {
+		t.Fatal("Expected the failed commit to be reported")
+	}
+	if _, exists := fake.refs["copy-branch"]; exists {
+		t.Error("a failed commit must not create the branch")
+	}
+
+	fake.failTrees = false
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if count := fake.commitCount("copy-branch"); count != 1 {
+		t.Errorf("Expected a single commit, got %d", count)
+	}
+	for _, path := range []string{"README.md", "docs/a.md", "docs/b.md", ".git-copy.lock"} {
+		if _, exists := fake.file("copy-branch", path); !exists {
+			t.Errorf("Expected %s in the commit", path)
+		}
+	}
+	lock, _ := fake.file("copy-branch", ".git-copy.lock")
+	if !strings.Contains(lock, `"source_path": "docs/a.md"`) {
+		t.Errorf("Expected the source path in the checkout to be recorded, got:\n%s", lock)
+	}
+	want := "README.md file created\n\nupdates files from source " + filepath.Join(source, "docs") + " to destination docs"
+	if got := fake.messages("copy-branch"); len(got) != 1 || !strings.HasPrefix(got[0], want) {
+		t.Errorf("unexpected commit messages: %q", got)
+	}
+
+	head := fake.refs["copy-branch"]
+	if err := os.WriteFile(filepath.Join(source, "docs", "b.md"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake.failTrees = true
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err == nil {
+		t.Fatal("Expected the failed commit to be reported")
+	}
+	if fake.refs["copy-branch"] != head {
+		t.Error("a failed commit must leave the branch unchanged")
+	}
+}
+
+// TestApplyPullRequestOptions tests labels, assignees, milestone and draft on created and existing pull requests
+func TestApplyPullRequestOptions(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{"config.json": "{}\n"})
+	fake.milestones[3] = "Q3 sync"
+	source := writeSourceDir(t, map[string]string{"config.json": "{\"a\": 1}\n"})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.FilePath = filepath.Join(source, "config.json")
+		env.Input.DestinationFilePath = "config.json"
+		env.Input.Labels = "automated-sync, dependencies"
+		env.Input.Assignees = "octocat"
+		env.Input.Milestone = "Q3 sync"
+		env.Input.Draft = "true"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	pull := fake.pulls[0]
+	if !pull.Draft {
+		t.Error("Expected a draft pull request")
+	}
+	if strings.Join(pull.Labels, ",") != "automated-sync,dependencies" {
+		t.Errorf("unexpected labels %v", pull.Labels)
+	}
+	if strings.Join(pull.Assignees, ",") != "octocat" {
+		t.Errorf("unexpected assignees %v", pull.Assignees)
+	}
+	if pull.Milestone != 3 {
+		t.Errorf("Expected milestone 3, got %d", pull.Milestone)
+	}
+
+	// A second run pushes to the existing branch and updates the open pull request
+	if err := os.WriteFile(filepath.Join(source, "config.json"), []byte("{\"a\": 2}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pull.Draft = false // marked ready for review in the meantime
+	env := gitcopy.GetEnvironment()
+	env.Input.Labels = "needs-review"
+	gitcopy.SetEnvironment(env)
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+		t.Fatalf("second apply failed: %v", err)
+	}
+	if len(fake.pulls) != 1 || !strings.Contains(out.String(), "pull request #1 updated") {
+		t.Errorf("Expected the existing pull request to be updated, output:\n%s", out.String())
+	}
+	if strings.Join(pull.Labels, ",") != "automated-sync,dependencies,needs-review" {
+		t.Errorf("unexpected labels after update %v", pull.Labels)
+	}
+	if !pull.Draft {
+		t.Error("Expected the existing pull request to be converted to a draft")
+	}
+
+	env.Input.Milestone = "missing"
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err == nil || !strings.Contains(err.Error(), `milestone "missing" not found`) {
+		t.Errorf("Expected unknown milestone error, got %v", err)
+	}
+
+	env.Input.Draft = "maybe"
+	gitcopy.SetEnvironment(env)
+	if _, err := gitcopy.ParsePullOptions(); err == nil {
+		t.Error("Expected invalid draft value error")
+	}
+}
+
+// TestApplyAutoMerge tests enabling auto-merge and the fallback when the repository does not allow it
+func TestApplyAutoMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+		output   string
+	}{
+		{"enabled", false, "auto-merge enabled on pull request #1"},
+		{"disabled in repository", true, "pull request #1 created"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGitHub(t, nil)
+			fake.autoMergeDisabled = tt.disabled
+			source := writeSourceDir(t, map[string]string{"sync.txt": "content\n"})
+			fake.useEnvironment(t, func(env *gitcopy.Environment) {
+				env.Input.FilePath = filepath.Join(source, "sync.txt")
+				env.Input.DestinationFilePath = "sync.txt"
+				env.Input.AutoMerge = "squash"
+			})
+
+			var out bytes.Buffer
+			if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+			if !strings.Contains(out.String(), tt.output) {
+				t.Errorf("output missing %q:\n%s", tt.output, out.String())
+			}
+			want := "SQUASH"
+			if tt.disabled {
+				want = ""
+			}
+			if got := fake.autoMerge["PR_1"]; got != want {
+				t.Errorf("Expected auto-merge method %q, got %q", want, got)
+			}
+		})
+	}
+
+	for _, value := range []string{"", "none", "merge", "squash", "rebase", " None "} {
+		if _, err := gitcopy.ParseAutoMerge(value); err != nil {
+			t.Errorf("ParseAutoMerge(%q) failed: %v", value, err)
+		}
+	}
+	if method, err := gitcopy.ParseAutoMerge(" Squash"); err != nil || method != "SQUASH" {
+		t.Errorf("ParseAutoMerge(%q) = %q, %v, expected SQUASH", " Squash", method, err)
+	}
+	if _, err := gitcopy.ParseAutoMerge("fast-forward"); err == nil {
+		t.Error("Expected error for unknown merge method")
+	}
+}
+
+// TestApplyDirectMode tests committing onto the base branch without a pull request
+func TestApplyDirectMode(t *testing.T) {
+	setup := func(t *testing.T) *fakeGitHub {
+		fake := newFakeGitHub(t, map[string]string{"docs/index.md": "old\n"})
+		source := writeSourceDir(t, map[string]string{"index.md": "new\n", "guide.md": "guide\n"})
+		fake.useEnvironment(t, func(env *gitcopy.Environment) {
+			env.Input.Directory = source
+			env.Input.DestinationDirectory = "docs"
+			env.Input.Mode = "direct"
+		})
+		return fake
+	}
+
+	t.Run("unprotected", func(t *testing.T) {
+		fake := setup(t)
+		var out bytes.Buffer
+		if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+			t.Fatalf("apply failed: %v", err)
+		}
+		if content, _ := fake.file("master", "docs/index.md"); content != "new\n" {
+			t.Errorf("Expected docs/index.md to be committed to master, got %q", content)
+		}
+		if _, exists := fake.file("master", "docs/guide.md"); !exists {
+			t.Error("Expected docs/guide.md to be committed to master")
+		}
+		if fake.commitCount("copy-branch") != 0 || len(fake.pulls) != 0 {
+			t.Error("direct mode must not create a branch or pull request")
+		}
+
+		out.Reset()
+		if err := gitcopy.Run(gitcopy.CommandStatus, &out); err != nil {
+			t.Fatalf("status failed: %v", err)
+		}
+		if !strings.Contains(out.String(), "in sync: master") || !strings.Contains(out.String(), "committed directly to master") {
+			t.Errorf("unexpected status output:\n%s", out.String())
+		}
+	})
+
+	t.Run("protected", func(t *testing.T) {
+		fake := setup(t)
+		fake.protection["master"] = map[string]any{"required_pull_request_reviews": map[string]any{"required_approving_review_count": 1}}
+		err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "pull request reviews are required") {
+			t.Errorf("Expected branch protection error, got %v", err)
+		}
+		if content, _ := fake.file("master", "docs/index.md"); content != "old\n" {
+			t.Errorf("nothing must be written to a protected branch, got %q", content)
+		}
+	})
+
+	t.Run("ruleset", func(t *testing.T) {
+		fake := setup(t)
+		fake.rules["master"] = []string{"deletion", "pull_request"}
+		err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "a ruleset requires a pull request") {
+			t.Errorf("Expected ruleset error, got %v", err)
+		}
+	})
+
+	t.Run("push rejected", func(t *testing.T) {
+		fake := setup(t)
+		fake.pushRejected["master"] = true
+		err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "direct commit to master was rejected") {
+			t.Errorf("Expected rejected push error, got %v", err)
+		}
+	})
+
+	if _, err := gitcopy.ParseMode("merge-queue"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+	if mode, err := gitcopy.ParseMode(" Direct "); err != nil || mode != gitcopy.ModeDirect {
+		t.Errorf("ParseMode(%q) = %q, %v, expected direct", " Direct ", mode, err)
+	}
+}
+
+// TestApplyTemplates tests the pull request title, body and commit message templates
+func TestApplyTemplates(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{"conf/a.yaml": "a: 1\n"})
+	source := writeSourceDir(t, map[string]string{"a.yaml": "a: 2\n", "b.yaml": "b: 1\n"})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.GitHub.Workflow = "sync"
+		env.GitHub.RunId = "42"
+		env.GitHub.Server = "https://github.com"
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "conf"
+		env.Input.PullDescription = "Routine sync"
+		env.Input.PrTitleTemplate = "sync {{ .SourceRepo }}@{{ .ShortSha }} ({{ len .Files }} files, first {{ (index .Files 0).Path }})"
+		env.Input.PrBodyTemplate = "{{ .Description }}\nRun: {{ .RunUrl }}\n{{ range .Files }}- {{ .Action }} {{ .Path }}\n{{ end }}{{ .Diffs }}"
+		env.Input.CommitMessageTemplate = "chore: sync from {{ .SourceRepo }} by {{ .Workflow }}\n\n{{ range .Files }}{{ .Path }}\n{{ end }}"
+	})
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	pull := fake.pulls[0]
+	if pull.Title != "sync source/repo@abc1234 (2 files, first conf/a.yaml)" {
+		t.Errorf("unexpected title %q", pull.Title)
+	}
+	for _, want := range []string{
+		"Routine sync\nRun: https://github.com/source/repo/actions/runs/42\n",
+		"- update conf/a.yaml\n- create conf/b.yaml\n",
+		"<summary>conf/a.yaml (update)</summary>",
+	} {
+		if !strings.Contains(pull.Body, want) {
+			t.Errorf("body missing %q:\n%s", want, pull.Body)
+		}
+	}
+	if messages := fake.messages("copy-branch"); len(messages) != 1 || !strings.HasPrefix(messages[0], "chore: sync from source/repo by sync\n\nconf/a.yaml\nconf/b.yaml\n\nSource-Repo:") {
+		t.Errorf("unexpected commit messages %q", messages)
+	}
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Errorf("Expected a run without changes to accept the templates, got %v", err)
+	}
+}
+
+// TestApplyInvalidTemplate tests that a broken template stops the run before anything is written
+func TestApplyInvalidTemplate(t *testing.T) {
+	for _, template := range []string{"{{ .Sha }", "{{ .Unknown }}"} {
+		fake := newFakeGitHub(t, nil)
+		source := writeSourceDir(t, map[string]string{"a.txt": "a\n"})
+		fake.useEnvironment(t, func(env *gitcopy.Environment) {
+			env.Input.FilePath = filepath.Join(source, "a.txt")
+			env.Input.DestinationFilePath = "a.txt"
+			env.Input.CommitMessageTemplate = template
+		})
+
+		err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), "invalid commit_message_template") {
+			t.Errorf("Expected template error for %q, got %v", template, err)
+		}
+		if fake.commitCount("copy-branch") != 0 {
+			t.Errorf("nothing must be written with template %q", template)
+		}
+	}
+}
+
+// TestFormatCommitMessage tests Conventional Commits subjects and trailers
+func TestFormatCommitMessage(t *testing.T) {
+	trailers := []string{"Source-Repo: org/source", "Source-Commit: abc"}
+	tests := []struct {
+		message, commitType, scope string
+		trailers                   []string
+		want                       string
+	}{
+		{"update files\n", "", "", nil, "update files"},
+		{"update files", "chore", "", nil, "chore: update files"},
+		{"update files", "docs", "sync", trailers, "docs(sync): update files\n\nSource-Repo: org/source\nSource-Commit: abc"},
+		{"update files\n\nbody\n", "", "", trailers[:1], "update files\n\nbody\n\nSource-Repo: org/source"},
+	}
+	for _, tt := range tests {
+		if got := gitcopy.FormatCommitMessage(tt.message, tt.commitType, tt.scope, tt.trailers); got != tt.want {
+			t.Errorf("FormatCommitMessage(%q, %q, %q) = %q, expected %q", tt.message, tt.commitType, tt.scope, got, tt.want)
+		}
+	}
+}
+
+// TestApplyConventionalCommits tests the commit type, scope and provenance trailers of the sync commits
+func TestApplyConventionalCommits(t *testing.T) {
+	fake := newFakeGitHub(t, nil)
+	fake.authors["abc1234def"] = "Jane Doe <jane@example.com>"
+	source := writeSourceDir(t, map[string]string{"a.txt": "a\n"})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.GitHub.RunId = "7"
+		env.GitHub.Server = "https://github.com"
+		env.Input.FilePath = filepath.Join(source, "a.txt")
+		env.Input.DestinationFilePath = "a.txt"
+		env.Input.LockFile = ".git-copy.lock"
+		env.Input.CommitType = "chore"
+		env.Input.CommitScope = "sync"
+		env.Input.CommitSignoff = "true"
+		env.Input.CommitCoAuthor = "true"
+	})
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	trailers := "\n\nSource-Repo: source/repo\nSource-Commit: abc1234def\n" +
+		"Source-Run: https://github.com/source/repo/actions/runs/7\n" +
+		"Signed-off-by: Jane Doe <jane@example.com>\nCo-authored-by: Jane Doe <jane@example.com>"
+	want := []string{"chore(sync): a.txt file created" + trailers}
+	if got := fake.messages("copy-branch"); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("unexpected commit messages:\n%q\nexpected:\n%q", got, want)
+	}
+
+	env := gitcopy.GetEnvironment()
+	env.Input.CommitType = "chore: sync"
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "invalid commit_type") {
+		t.Errorf("Expected invalid commit_type error, got %v", err)
+	}
+}
+
+// TestApplyCommitIdentity tests setting the author and committer of the sync commits
+func TestApplyCommitIdentity(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(env *gitcopy.Environment)
+		author    string
+		committer string
+	}{
+		{
+			name: "explicit",
+			configure: func(env *gitcopy.Environment) {
+				env.Input.CommitAuthorName = "Release Bot"
+				env.Input.CommitAuthorEmail = "bot@example.com"
+				env.Input.CommitterName = "Platform Team"
+				env.Input.CommitterEmail = "platform@example.com"
+			},
+			author:    "Release Bot <bot@example.com>",
+			committer: "Platform Team <platform@example.com>",
+		},
+		{
+			name: "from source",
+			configure: func(env *gitcopy.Environment) {
+				env.Input.CommitAuthorFromSource = "true"
+			},
+			author: "Jane Doe <jane@example.com>",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeGitHub(t, map[string]string{"docs/a.md": "old\n"})
+			fake.authors["abc1234def"] = "Jane Doe <jane@example.com>"
+			source := writeSourceDir(t, map[string]string{"a.md": "new\n", "bin.dat": "\x00\xff\x10"})
+			fake.useEnvironment(t, func(env *gitcopy.Environment) {
+				env.Input.Directory = source
+				env.Input.DestinationDirectory = "docs"
+				tt.configure(env)
+			})
+
+			if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+				t.Fatalf("apply failed: %v", err)
+			}
+			head := fake.head("copy-branch")
+			if head.Author != tt.author || head.Committer != tt.committer {
+				t.Errorf("Expected author %q and committer %q, got %q and %q", tt.author, tt.committer, head.Author, head.Committer)
+			}
+			if content, _ := fake.file("copy-branch", "docs/a.md"); content != "new\n" {
+				t.Errorf("unexpected content of docs/a.md %q", content)
+			}
+			if content, _ := fake.file("copy-branch", "docs/bin.dat"); content != "\x00\xff\x10" {
+				t.Errorf("binary content was not preserved: %q", content)
+			}
+		})
+	}
+
+	fake := newFakeGitHub(t, nil)
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.FilePath = "commands_test.go"
+		env.Input.DestinationFilePath = "a.go"
+		env.Input.CommitAuthorName = "Only Name"
+	})
+	err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "commit_author_name and commit_author_email must be set together") {
+		t.Errorf("Expected incomplete identity error, got %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestGitBlobSha tests that blob SHAs match the ones git computes
+func TestGitBlobSha(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"", "e69de29bb2d1d6434b8b29ae775ad8c2e48c5391"},
+		{"hello\n", "ce013625030ba8dba906f756967f9e9ca394464a"},
+	}
+
+	for _, tt := range tests {
+		if sha := gitcopy.GitBlobSha([]byte(tt.content)); sha != tt.expected {
+			t.Errorf("Expected blob SHA %s for %q, got %s", tt.expected, tt.content, sha)
+		}
+	}
+}
+
+// TestLockfileRoundTrip tests encoding and decoding of the lockfile
+func TestLockfileRoundTrip(t *testing.T) {
+	lock := gitcopy.NewLockfile()
+	lock.Files["configs/app.json"] = gitcopy.LockEntry{
+		Sha:          "ce013625030ba8dba906f756967f9e9ca394464a",
+		Source:       "./config/app.json",
+		SourcePath:   "config/app.json",
+		SourceRepo:   "test/repo",
+		SourceCommit: "abc123",
+	}
+
+	data, err := lock.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.HasSuffix(string(data), "\n") {
+		t.Error("Lockfile should end with a newline")
+	}
+
+	parsed, err := gitcopy.ParseLockfile(data)
+	if err != nil {
+		t.Fatalf("ParseLockfile failed: %v", err)
+	}
+	if parsed.Files["configs/app.json"] != lock.Files["configs/app.json"] {
+		t.Errorf("Expected entry %+v, got %+v", lock.Files["configs/app.json"], parsed.Files["configs/app.json"])
+	}
+}
+
+// TestParseLockfileErrors tests empty and invalid lockfiles
+func TestParseLockfileErrors(t *testing.T) {
+	lock, err := gitcopy.ParseLockfile(nil)
+	if err != nil {
+		t.Fatalf("Empty lockfile should parse, got: %v", err)
+	}
+	if len(lock.Files) != 0 {
+		t.Errorf("Expected empty lockfile, got %d entries", len(lock.Files))
+	}
+
+	if _, err := gitcopy.ParseLockfile([]byte("not json")); err == nil {
+		t.Error("Expected error for invalid lockfile, got nil")
+	}
+
+	if _, err := gitcopy.ParseLockfile([]byte(`{"version": 99, "files": {}}`)); err == nil {
+		t.Error("Expected error for unsupported lockfile version, got nil")
+	}
+}
+
+// TestParseConflictPolicy tests on_conflict input validation
+func TestParseConflictPolicy(t *testing.T) {
+	tests := []struct {
+		input      string
+		expected   gitcopy.ConflictPolicy
+		shouldFail bool
+	}{
+		{"", gitcopy.ConflictOverwrite, false},
+		{"overwrite", gitcopy.ConflictOverwrite, false},
+		{"skip", gitcopy.ConflictSkip, false},
+		{"FAIL", gitcopy.ConflictFail, false},
+		{" annotate-pr ", gitcopy.ConflictAnnotate, false},
+		{"merge", "", true},
+	}
+
+	for _, tt := range tests {
+		policy, err := gitcopy.ParseConflictPolicy(tt.input)
+		if tt.shouldFail {
+			if err == nil {
+				t.Errorf("Expected error for %q, got nil", tt.input)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %v", tt.input, err)
+		}
+		if policy != tt.expected {
+			t.Errorf("Expected policy %s for %q, got %s", tt.expected, tt.input, policy)
+		}
+	}
+}
+
+// TestDetectConflict tests conflict detection against the lockfile
+func TestDetectConflict(t *testing.T) {
+	lock := gitcopy.NewLockfile()
+	lock.Files["docs/guide.md"] = gitcopy.LockEntry{Sha: "aaaaaaaaaa", Source: "guide.md"}
+
+	if conflict := gitcopy.DetectConflict(lock, "docs/guide.md", "aaaaaaaaaa"); conflict != nil {
+		t.Errorf("Unchanged destination should not conflict, got %+v", conflict)
+	}
+
+	if conflict := gitcopy.DetectConflict(lock, "docs/other.md", "bbbbbbbbbb"); conflict != nil {
+		t.Errorf("File without lock entry should not conflict, got %+v", conflict)
+	}
+
+	if conflict := gitcopy.DetectConflict(nil, "docs/guide.md", "bbbbbbbbbb"); conflict != nil {
+		t.Errorf("Missing lockfile should not conflict, got %+v", conflict)
+	}
+
+	conflict := gitcopy.DetectConflict(lock, "docs/guide.md", "bbbbbbbbbb")
+	if conflict == nil {
+		t.Fatal("Expected conflict for modified destination, got nil")
+	}
+	if conflict.LastSyncedSha != "aaaaaaaaaa" || conflict.CurrentSha != "bbbbbbbbbb" || conflict.Source != "guide.md" {
+		t.Errorf("Unexpected conflict details: %+v", conflict)
+	}
+}
+
+// TestFormatConflicts tests the pull request section listing conflicts
+func TestFormatConflicts(t *testing.T) {
+	conflicts := []gitcopy.Conflict{
+		{Path: "docs/guide.md", LastSyncedSha: "aaaaaaaaaa", CurrentSha: "bbbbbbbbbb"},
+	}
+
+	if lines := gitcopy.FormatConflicts(gitcopy.ConflictOverwrite, nil); lines != nil {
+		t.Errorf("Expected no lines without conflicts, got %v", lines)
+	}
+
+	skipped := strings.Join(gitcopy.FormatConflicts(gitcopy.ConflictSkip, conflicts), "\n")
+	if !strings.Contains(skipped, "left unchanged") || !strings.Contains(skipped, "`docs/guide.md` (last synced aaaaaaa, now bbbbbbb)") {
+		t.Errorf("Unexpected skip section: %s", skipped)
+	}
+
+	annotated := gitcopy.FormatConflicts(gitcopy.ConflictAnnotate, conflicts)
+	for _, line := range annotated {
+		if !strings.HasPrefix(line, ">") {
+			t.Errorf("Annotated conflict lines should be quoted, got: %s", line)
+		}
+	}
+}
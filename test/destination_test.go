@@ -0,0 +1,147 @@
+package cmd_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestDestinationPath tests normalizing destination paths and rejecting paths outside the repository
+func TestDestinationPath(t *testing.T) {
+	valid := map[string]string{
+		"docs/guide.md":      "docs/guide.md",
+		`docs\windows\a.md`:  "docs/windows/a.md",
+		"./config//app.yaml": "config/app.yaml",
+		"public-docs/":       "public-docs",
+		".":                  ".",
+	}
+	for input, want := range valid {
+		got, err := gitcopy.DestinationPath(input)
+		if err != nil || got != want {
+			t.Errorf("DestinationPath(%q) = %q, %v, expected %q", input, got, err, want)
+		}
+	}
+
+	for _, input := range []string{"../outside.md", `docs\..\..\etc\passwd`, "docs/../README.md", "/etc/passwd", `C:\repo\file.md`, "c:file.md"} {
+		if _, err := gitcopy.DestinationPath(input); err == nil {
+			t.Errorf("Expected DestinationPath(%q) to fail", input)
+		}
+	}
+}
+
+// TestPathAllowlist tests matching destination paths against allowed_destination_paths
+func TestPathAllowlist(t *testing.T) {
+	allowlist, err := gitcopy.ParsePathAllowlist("docs/\n/config/*.yaml, *.md, **/*.txt")
+	if err != nil {
+		t.Fatalf("ParsePathAllowlist failed: %v", err)
+	}
+	tests := map[string]bool{
+		"docs/guide.md":          true,
+		"docs/nested/image.png":  true,
+		"config/app.yaml":        true,
+		"config/nested/app.yaml": false,
+		"README.md":              true,
+		"src/main.go":            false,
+		"docsite/index.html":     false,
+		"any/nested/docs/x.md":   false,
+		"src/README.md":          false,
+		"notes/a/todo.txt":       true,
+	}
+	for path, want := range tests {
+		if got := allowlist.Allows(path); got != want {
+			t.Errorf("Allows(%q) = %v, expected %v", path, got, want)
+		}
+	}
+
+	empty, err := gitcopy.ParsePathAllowlist("")
+	if err != nil || !empty.Allows("anything/at/all") {
+		t.Errorf("Expected an empty allowlist to allow every path, got %v", err)
+	}
+	if _, err := gitcopy.ParsePathAllowlist("!docs/"); err == nil {
+		t.Error("Expected an unsupported pattern to fail")
+	}
+}
+
+// TestApplyDestinationSafety tests that unsafe or disallowed destinations fail before anything is written
+func TestApplyDestinationSafety(t *testing.T) {
+	fake := newFakeGitHub(t, nil)
+	source := writeSourceDir(t, map[string]string{"guide.md": "guide\n", "app.yaml": "app: true\n"})
+
+	tests := []struct {
+		name      string
+		configure func(env *gitcopy.Environment)
+		wantErr   string
+	}{
+		{
+			name: "file traversal",
+			configure: func(env *gitcopy.Environment) {
+				env.Input.FilePath = filepath.Join(source, "guide.md")
+				env.Input.DestinationFilePath = "docs/../../guide.md"
+			},
+			wantErr: "must not contain ..",
+		},
+		{
+			name: "absolute directory",
+			configure: func(env *gitcopy.Environment) {
+				env.Input.Directory = source
+				env.Input.DestinationDirectory = "/docs"
+			},
+			wantErr: "must be relative to the repository root",
+		},
+		{
+			name: "rename traversal",
+			configure: func(env *gitcopy.Environment) {
+				env.Input.Directory = source
+				env.Input.DestinationDirectory = "docs"
+				env.Input.Rename = "regex:^(.*)$ -> ../$1"
+			},
+			wantErr: "must not contain ..",
+		},
+		{
+			name: "outside allowlist",
+			configure: func(env *gitcopy.Environment) {
+				env.Input.Directory = source
+				env.Input.DestinationDirectory = "docs"
+				env.Input.AllowedDestinationPaths = "docs/*.md"
+			},
+			wantErr: "destination path docs/app.yaml is not in allowed_destination_paths",
+		},
+		{
+			name: "lockfile outside allowlist",
+			configure: func(env *gitcopy.Environment) {
+				env.Input.Directory = source
+				env.Input.DestinationDirectory = "docs"
+				env.Input.LockFile = ".git-copy.lock"
+				env.Input.AllowedDestinationPaths = "docs/"
+			},
+			wantErr: "destination path .git-copy.lock is not in allowed_destination_paths",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.useEnvironment(t, tt.configure)
+			err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if _, exists := fake.refs["copy-branch"]; exists {
+				t.Error("nothing must be written when a destination path is rejected")
+			}
+		})
+	}
+
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = `public\docs\`
+		env.Input.AllowedDestinationPaths = "public/docs/"
+	})
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if content, _ := fake.file("copy-branch", "public/docs/guide.md"); content != "guide\n" {
+		t.Errorf("Expected the file under the normalized directory, got %q", content)
+	}
+}
@@ -0,0 +1,903 @@
+package cmd_test
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	pathpkg "path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+const (
+	fakeOwner = "test-owner"
+	fakeRepo  = "test-repo"
+)
+
+// fakeEntry is a file in a fake tree
+type fakeEntry struct {
+	Mode string
+	Sha  string
+}
+
+// fakeCommit is a commit in the fake repository
+type fakeCommit struct {
+	Tree      string
+	Parents   []string
+	Message   string
+	Author    string // "Name <email>", empty for the token owner
+	Committer string
+	Signature string
+	Payload   string // raw commit object the signature is verified against
+}
+
+// fakePull is a pull request in the fake repository
+type fakePull struct {
+	Number int
+	Title  string
+	Body   string
+	Head   string
+	Base   string
+	State  string
+	Draft  bool
+
+	Labels    []string
+	Assignees []string
+	Milestone int
+}
+
+// fakeIssue is an issue in the fake repository
+type fakeIssue struct {
+	Number   int
+	Title    string
+	Body     string
+	State    string
+	Comments []string
+}
+
+// fakeGitHub serves the subset of the GitHub REST API used by git-copy for a
+// single repository, keeping blobs, trees, commits and refs in memory
+type fakeGitHub struct {
+	t      *testing.T
+	mu     sync.Mutex
+	server *httptest.Server
+
+	blobs   map[string][]byte
+	trees   map[string]map[string]fakeEntry
+	commits map[string]fakeCommit
+	refs    map[string]string
+	pulls   []*fakePull
+	// issues holds the issues by number, numbered from fakeIssueBase to stay clear of pull requests
+	issues map[int]*fakeIssue
+	// reviewers holds the requested reviewers of each pull request, teams prefixed with "team:"
+	reviewers map[int][]string
+	login     string
+	// authors holds "Name <email>" of source repository commits by SHA
+	authors    map[string]string
+	milestones map[int]string
+	autoMerge  map[string]string
+	// protection holds the classic branch protection of protected branches
+	protection map[string]map[string]any
+	// rules holds the ruleset rule types active on a branch
+	rules map[string][]string
+	// pushRejected rejects every write to a branch, like push restrictions that are not visible to the token
+	pushRejected map[string]bool
+	// lfsObjects and sourceLFSObjects are the Git LFS stores of the repository and of source/repo by oid
+	lfsObjects       map[string][]byte
+	sourceLFSObjects map[string][]byte
+	// failTrees makes tree creation fail, interrupting a commit after its blobs are uploaded
+	failTrees bool
+	// autoMergeDisabled makes the repository reject auto-merge like GitHub does when it is turned off
+	autoMergeDisabled bool
+	requests          []string
+	counter           int
+}
+
+// newFakeGitHub starts a fake GitHub API with a master branch holding files
+func newFakeGitHub(t *testing.T, files map[string]string) *fakeGitHub {
+	t.Helper()
+	f := &fakeGitHub{
+		t:          t,
+		blobs:      make(map[string][]byte),
+		trees:      make(map[string]map[string]fakeEntry),
+		commits:    make(map[string]fakeCommit),
+		refs:       make(map[string]string),
+		reviewers:  make(map[int][]string),
+		milestones: make(map[int]string),
+		issues:     make(map[int]*fakeIssue),
+		autoMerge:  make(map[string]string),
+		authors:    make(map[string]string),
+		protection: make(map[string]map[string]any),
+		rules:      make(map[string][]string),
+
+		pushRejected:     make(map[string]bool),
+		lfsObjects:       make(map[string][]byte),
+		sourceLFSObjects: make(map[string][]byte),
+	}
+	tree := make(map[string]fakeEntry)
+	for path, content := range files {
+		tree[path] = fakeEntry{Mode: "100644", Sha: f.storeBlob([]byte(content))}
+	}
+	f.refs["master"] = f.storeCommit(fakeCommit{Tree: f.storeTree(tree), Message: "initial commit"})
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// useEnvironment points git-copy at the fake server for the duration of the test
+func (f *fakeGitHub) useEnvironment(t *testing.T, configure func(env *gitcopy.Environment)) {
+	t.Helper()
+	originalEnv := gitcopy.GetEnvironment()
+	t.Cleanup(func() { gitcopy.SetEnvironment(originalEnv) })
+
+	env := gitcopy.Environment{}
+	env.GitHub.Token = "test-token"
+	env.GitHub.Api = f.server.URL
+	env.GitHub.Repo = "source/repo"
+	env.GitHub.Commit = "abc1234def"
+	env.Input.Owner = fakeOwner
+	env.Input.Repo = fakeRepo
+	env.Input.RefBranch = "master"
+	env.Input.Branch = "copy-branch"
+	if configure != nil {
+		configure(&env)
+	}
+	gitcopy.SetEnvironment(env)
+}
+
+// file returns the content of path on branch
+func (f *fakeGitHub) file(branch string, path string) (string, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	commit, ok := f.refs[branch]
+	if !ok {
+		return "", false
+	}
+	entry, ok := f.trees[f.commits[commit].Tree][path]
+	if !ok {
+		return "", false
+	}
+	return string(f.blobs[entry.Sha]), true
+}
+
+// mode returns the git file mode of path on branch
+func (f *fakeGitHub) mode(branch string, path string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.trees[f.commits[f.refs[branch]].Tree][path].Mode
+}
+
+// commitCount returns the number of commits on branch that are not on master
+func (f *fakeGitHub) commitCount(branch string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	count := 0
+	for sha := f.refs[branch]; sha != "" && sha != f.refs["master"]; {
+		count++
+		parents := f.commits[sha].Parents
+		if len(parents) == 0 {
+			break
+		}
+		sha = parents[0]
+	}
+	return count
+}
+
+// messages returns the messages of the commits on branch that are not on master, newest first
+func (f *fakeGitHub) messages(branch string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var messages []string
+	for sha := f.refs[branch]; sha != "" && sha != f.refs["master"]; {
+		messages = append(messages, f.commits[sha].Message)
+		parents := f.commits[sha].Parents
+		if len(parents) == 0 {
+			break
+		}
+		sha = parents[0]
+	}
+	return messages
+}
+
+// head returns the head commit of branch
+func (f *fakeGitHub) head(branch string) fakeCommit {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.commits[f.refs[branch]]
+}
+
+// commitFile commits content to path on branch, simulating an edit made directly in the destination
+func (f *fakeGitHub) commitFile(branch string, path string, content string) {
+	f.commitFileMode(branch, path, content, "100644")
+}
+
+// commitFileMode commits content to path on branch with the given git file mode
+func (f *fakeGitHub) commitFileMode(branch string, path string, content string, mode string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	head := f.refs[branch]
+	tree := f.copyTree(f.commits[head].Tree)
+	tree[path] = fakeEntry{Mode: mode, Sha: f.storeBlob([]byte(content))}
+	f.refs[branch] = f.storeCommit(fakeCommit{Tree: f.storeTree(tree), Parents: []string{head}, Message: "edit " + path})
+}
+
+func (f *fakeGitHub) hash(parts ...string) string {
+	f.counter++
+	h := sha1.New()
+	_, _ = fmt.Fprintf(h, "%d", f.counter)
+	for _, part := range parts {
+		_, _ = io.WriteString(h, part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (f *fakeGitHub) storeBlob(content []byte) string {
+	sha := gitcopy.GitBlobSha(content)
+	f.blobs[sha] = content
+	return sha
+}
+
+func (f *fakeGitHub) storeTree(tree map[string]fakeEntry) string {
+	paths := make([]string, 0, len(tree))
+	for path := range tree {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s %s %s\n", tree[path].Mode, tree[path].Sha, path)
+	}
+	sha := f.hash("tree", b.String())
+	f.trees[sha] = tree
+	return sha
+}
+
+func (f *fakeGitHub) storeCommit(commit fakeCommit) string {
+	sha := f.hash("commit", commit.Tree, commit.Message, strings.Join(commit.Parents, ","))
+	f.commits[sha] = commit
+	return sha
+}
+
+func (f *fakeGitHub) copyTree(sha string) map[string]fakeEntry {
+	tree := make(map[string]fakeEntry)
+	for path, entry := range f.trees[sha] {
+		tree[path] = entry
+	}
+	return tree
+}
+
+func (f *fakeGitHub) writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
+
+func (f *fakeGitHub) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+
+	if r.URL.Path == "/graphql" {
+		f.serveGraphQL(w, r)
+		return
+	}
+	if r.URL.Path == "/user" {
+		if f.login == "" {
+			f.writeJSON(w, http.StatusForbidden, map[string]string{"message": "Resource not accessible by integration"})
+			return
+		}
+		f.writeJSON(w, http.StatusOK, map[string]string{"login": f.login})
+		return
+	}
+
+	if strings.HasSuffix(r.URL.Path, ".git/info/lfs/objects/batch") || strings.HasPrefix(r.URL.Path, "/lfs/") {
+		f.serveLFS(w, r)
+		return
+	}
+
+	prefix := fmt.Sprintf("/repos/%s/%s/", fakeOwner, fakeRepo)
+	if _, sha, ok := strings.Cut(r.URL.Path, "/commits/"); ok && !strings.HasPrefix(r.URL.Path, prefix) {
+		name, email, _ := strings.Cut(strings.TrimSuffix(f.authors[sha], ">"), " <")
+		if name == "" {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		f.writeJSON(w, http.StatusOK, map[string]any{"sha": sha, "commit": map[string]any{"author": map[string]string{"name": name, "email": email}}})
+		return
+	}
+	if r.URL.Path == strings.TrimSuffix(prefix, "/") {
+		f.writeJSON(w, http.StatusOK, map[string]string{"full_name": fakeOwner + "/" + fakeRepo, "default_branch": "master"})
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, prefix)
+	var body map[string]any
+	if r.Body != nil {
+		data, _ := io.ReadAll(r.Body)
+		if len(data) > 0 {
+			if err := json.Unmarshal(data, &body); err != nil {
+				f.writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+				return
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(path, "git/refs/heads/"):
+		f.serveRef(w, r, strings.TrimPrefix(path, "git/refs/heads/"), body)
+	case path == "git/refs" && r.Method == http.MethodPost:
+		branch := strings.TrimPrefix(body["ref"].(string), "refs/heads/")
+		if _, exists := f.refs[branch]; exists {
+			f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Reference already exists"})
+			return
+		}
+		f.refs[branch] = body["sha"].(string)
+		f.writeJSON(w, http.StatusCreated, map[string]any{"ref": body["ref"], "object": map[string]string{"sha": f.refs[branch]}})
+	case strings.HasPrefix(path, "contents/"):
+		f.serveContents(w, r, strings.TrimPrefix(path, "contents/"), body)
+	case strings.HasPrefix(path, "git/blobs"):
+		f.serveBlob(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "git/blobs"), "/"), body)
+	case path == "git/trees" && r.Method == http.MethodPost && f.failTrees:
+		f.writeJSON(w, http.StatusInternalServerError, map[string]string{"message": "Server Error"})
+	case path == "git/trees" && r.Method == http.MethodPost:
+		f.serveCreateTree(w, body)
+	case strings.HasPrefix(path, "git/trees/") && r.Method == http.MethodGet:
+		f.serveTree(w, strings.TrimPrefix(path, "git/trees/"))
+	case strings.HasPrefix(path, "commits/") && r.Method == http.MethodGet:
+		ref := strings.TrimPrefix(path, "commits/")
+		sha, ok := f.refs[ref]
+		if !ok {
+			sha = ref
+		}
+		commit, ok := f.commits[sha]
+		if !ok {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "No commit found for SHA: " + ref})
+			return
+		}
+		f.writeJSON(w, http.StatusOK, map[string]any{"sha": sha, "commit": map[string]any{"message": commit.Message, "tree": map[string]string{"sha": commit.Tree}}})
+	case strings.HasPrefix(path, "git/commits"):
+		f.serveCommit(w, r, strings.TrimPrefix(strings.TrimPrefix(path, "git/commits"), "/"), body)
+	case path == "pulls":
+		f.servePulls(w, r, body)
+	case strings.HasPrefix(path, "pulls/") && r.Method == http.MethodPatch:
+		number, _ := strconv.Atoi(strings.TrimPrefix(path, "pulls/"))
+		if number < 1 || number > len(f.pulls) {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		pull := f.pulls[number-1]
+		pull.Title, _ = body["title"].(string)
+		pull.Body, _ = body["body"].(string)
+		f.writeJSON(w, http.StatusOK, f.pullJSON(pull))
+	case strings.HasPrefix(path, "pulls/") && strings.HasSuffix(path, "/requested_reviewers"):
+		number, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(path, "pulls/"), "/requested_reviewers"))
+		for key, prefix := range map[string]string{"reviewers": "", "team_reviewers": "team:"} {
+			if list, ok := body[key].([]any); ok {
+				for _, item := range list {
+					f.reviewers[number] = append(f.reviewers[number], prefix+item.(string))
+				}
+			}
+		}
+		f.writeJSON(w, http.StatusCreated, map[string]any{"number": number})
+	case strings.HasPrefix(path, "branches/") && r.Method == http.MethodGet:
+		branch, protection := strings.CutSuffix(strings.TrimPrefix(path, "branches/"), "/protection")
+		sha, ok := f.refs[branch]
+		rules, protected := f.protection[branch]
+		switch {
+		case !ok || protection && !protected:
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		case protection:
+			f.writeJSON(w, http.StatusOK, rules)
+		default:
+			f.writeJSON(w, http.StatusOK, map[string]any{"name": branch, "protected": protected, "commit": map[string]string{"sha": sha}})
+		}
+	case strings.HasPrefix(path, "rules/branches/") && r.Method == http.MethodGet:
+		result := []map[string]string{}
+		for _, rule := range f.rules[strings.TrimPrefix(path, "rules/branches/")] {
+			result = append(result, map[string]string{"type": rule})
+		}
+		f.writeJSON(w, http.StatusOK, result)
+	case path == "issues":
+		f.serveIssues(w, r, body)
+	case strings.HasPrefix(path, "issues/"):
+		f.serveIssue(w, r, strings.TrimPrefix(path, "issues/"), body)
+	case path == "milestones" && r.Method == http.MethodGet:
+		result := []map[string]any{}
+		for number, title := range f.milestones {
+			result = append(result, map[string]any{"number": number, "title": title, "state": "open"})
+		}
+		f.writeJSON(w, http.StatusOK, result)
+	default:
+		f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+	}
+}
+
+// serveIssue handles the issue endpoints used to label, assign and set the milestone of pull requests
+func (f *fakeGitHub) serveIssue(w http.ResponseWriter, r *http.Request, path string, body map[string]any) {
+	id, action, _ := strings.Cut(path, "/")
+	number, _ := strconv.Atoi(id)
+	if issue, ok := f.issues[number]; ok {
+		switch {
+		case action == "comments" && r.Method == http.MethodPost:
+			issue.Comments = append(issue.Comments, body["body"].(string))
+			f.writeJSON(w, http.StatusCreated, map[string]any{"body": body["body"]})
+		case action == "" && r.Method == http.MethodPatch:
+			for key, field := range map[string]*string{"title": &issue.Title, "body": &issue.Body, "state": &issue.State} {
+				if value, ok := body[key].(string); ok {
+					*field = value
+				}
+			}
+			f.writeJSON(w, http.StatusOK, f.issueJSON(issue))
+		default:
+			f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+		}
+		return
+	}
+	if number < 1 || number > len(f.pulls) {
+		f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	pull := f.pulls[number-1]
+	list := func(key string) []string {
+		var items []string
+		values, _ := body[key].([]any)
+		for _, item := range values {
+			items = append(items, item.(string))
+		}
+		return items
+	}
+	switch {
+	case action == "labels" && r.Method == http.MethodPost:
+		pull.Labels = append(pull.Labels, list("labels")...)
+		f.writeJSON(w, http.StatusOK, []any{})
+	case action == "assignees" && r.Method == http.MethodPost:
+		pull.Assignees = append(pull.Assignees, list("assignees")...)
+		f.writeJSON(w, http.StatusCreated, f.pullJSON(pull))
+	case action == "" && r.Method == http.MethodPatch:
+		if milestone, ok := body["milestone"].(float64); ok {
+			if _, exists := f.milestones[int(milestone)]; !exists {
+				f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Validation Failed"})
+				return
+			}
+			pull.Milestone = int(milestone)
+		}
+		f.writeJSON(w, http.StatusOK, f.pullJSON(pull))
+	default:
+		f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+// serveGraphQL handles the enablePullRequestAutoMerge and convertPullRequestToDraft mutations
+func (f *fakeGitHub) serveGraphQL(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Query     string            `json:"query"`
+		Variables map[string]string `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		f.writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+		return
+	}
+	if strings.Contains(request.Query, "convertPullRequestToDraft") {
+		for _, pull := range f.pulls {
+			if fmt.Sprintf("PR_%d", pull.Number) == request.Variables["id"] {
+				pull.Draft = true
+				f.writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"convertPullRequestToDraft": map[string]any{"pullRequest": map[string]any{"number": pull.Number}}}})
+				return
+			}
+		}
+		f.writeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": "Could not resolve to a node"}}})
+		return
+	}
+	if !strings.Contains(request.Query, "enablePullRequestAutoMerge") {
+		f.writeJSON(w, http.StatusOK, map[string]any{"errors": []map[string]string{{"message": "unsupported query"}}})
+		return
+	}
+	if f.autoMergeDisabled {
+		f.writeJSON(w, http.StatusOK, map[string]any{
+			"data":   map[string]any{"enablePullRequestAutoMerge": nil},
+			"errors": []map[string]string{{"message": "Pull request Auto merge is not allowed for this repository"}},
+		})
+		return
+	}
+	f.autoMerge[request.Variables["id"]] = request.Variables["method"]
+	f.writeJSON(w, http.StatusOK, map[string]any{"data": map[string]any{"enablePullRequestAutoMerge": map[string]any{"pullRequest": map[string]any{"number": 1}}}})
+}
+
+func (f *fakeGitHub) serveRef(w http.ResponseWriter, r *http.Request, branch string, body map[string]any) {
+	switch r.Method {
+	case http.MethodGet:
+		sha, ok := f.refs[branch]
+		if !ok {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		f.writeJSON(w, http.StatusOK, map[string]any{"ref": "refs/heads/" + branch, "object": map[string]string{"sha": sha, "type": "commit"}})
+	case http.MethodPatch:
+		if f.pushRejected[branch] {
+			f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Protected branch update failed"})
+			return
+		}
+		sha := body["sha"].(string)
+		if _, ok := f.commits[sha]; !ok {
+			f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Object does not exist"})
+			return
+		}
+		f.refs[branch] = sha
+		f.writeJSON(w, http.StatusOK, map[string]any{"ref": "refs/heads/" + branch, "object": map[string]string{"sha": sha}})
+	default:
+		f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (f *fakeGitHub) serveContents(w http.ResponseWriter, r *http.Request, path string, body map[string]any) {
+	switch r.Method {
+	case http.MethodGet:
+		ref := r.URL.Query().Get("ref")
+		commit, ok := f.refs[ref]
+		if !ok {
+			commit = ref
+		}
+		tree := f.trees[f.commits[commit].Tree]
+		entry, ok := tree[path]
+		if !ok {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		if entry.Mode == "120000" {
+			// Like GitHub, a link to a file of the repository returns the file it points to
+			target := pathpkg.Join(pathpkg.Dir(path), string(f.blobs[entry.Sha]))
+			resolved, ok := tree[target]
+			if !ok || resolved.Mode == "120000" {
+				f.writeJSON(w, http.StatusOK, map[string]any{"name": path, "path": path, "sha": entry.Sha, "type": "symlink", "target": string(f.blobs[entry.Sha])})
+				return
+			}
+			path, entry = target, resolved
+		}
+		// GitHub wraps base64 content at 60 characters
+		encoded := base64.StdEncoding.EncodeToString(f.blobs[entry.Sha])
+		var wrapped []string
+		for len(encoded) > 60 {
+			wrapped = append(wrapped, encoded[:60])
+			encoded = encoded[60:]
+		}
+		wrapped = append(wrapped, encoded)
+		f.writeJSON(w, http.StatusOK, map[string]any{
+			"name": path, "path": path, "sha": entry.Sha, "type": "file",
+			"content": strings.Join(wrapped, "\n") + "\n", "encoding": "base64",
+		})
+	case http.MethodPut:
+		branch := body["branch"].(string)
+		if f.pushRejected[branch] {
+			f.writeJSON(w, http.StatusConflict, map[string]string{"message": "Protected branch update failed"})
+			return
+		}
+		head, ok := f.refs[branch]
+		if !ok {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Branch not found"})
+			return
+		}
+		tree := f.copyTree(f.commits[head].Tree)
+		existing, exists := tree[path]
+		sha, _ := body["sha"].(string)
+		if exists && sha != existing.Sha || !exists && sha != "" {
+			f.writeJSON(w, http.StatusConflict, map[string]string{"message": "sha does not match"})
+			return
+		}
+		content, err := base64.StdEncoding.DecodeString(body["content"].(string))
+		if err != nil {
+			f.writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+		tree[path] = fakeEntry{Mode: "100644", Sha: f.storeBlob(content)}
+		commit := f.storeCommit(fakeCommit{Tree: f.storeTree(tree), Parents: []string{head}, Message: body["message"].(string)})
+		f.refs[branch] = commit
+		status := http.StatusCreated
+		if exists {
+			status = http.StatusOK
+		}
+		f.writeJSON(w, status, map[string]any{"content": map[string]string{"path": path, "sha": tree[path].Sha}, "commit": map[string]string{"sha": commit}})
+	default:
+		f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (f *fakeGitHub) serveBlob(w http.ResponseWriter, r *http.Request, sha string, body map[string]any) {
+	switch r.Method {
+	case http.MethodGet:
+		content, ok := f.blobs[sha]
+		if !ok {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		f.writeJSON(w, http.StatusOK, map[string]any{"sha": sha, "content": base64.StdEncoding.EncodeToString(content), "encoding": "base64"})
+	case http.MethodPost:
+		content := []byte(body["content"].(string))
+		if body["encoding"] == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(body["content"].(string))
+			if err != nil {
+				f.writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+				return
+			}
+			content = decoded
+		}
+		f.writeJSON(w, http.StatusCreated, map[string]string{"sha": f.storeBlob(content)})
+	default:
+		f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+// serveLFS serves the LFS batch API of the repository and of source/repo, and the
+// transfer URLs it hands out under /lfs/
+func (f *fakeGitHub) serveLFS(w http.ResponseWriter, r *http.Request) {
+	if _, token, ok := r.BasicAuth(); strings.HasSuffix(r.URL.Path, "/batch") && (!ok || token != "test-token") {
+		f.writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Bad credentials"})
+		return
+	}
+	data, _ := io.ReadAll(r.Body)
+	switch r.URL.Path {
+	case fmt.Sprintf("/%s/%s.git/info/lfs/objects/batch", fakeOwner, fakeRepo), "/source/repo.git/info/lfs/objects/batch":
+		var request struct {
+			Operation string `json:"operation"`
+			Objects   []struct {
+				Oid  string `json:"oid"`
+				Size int64  `json:"size"`
+			} `json:"objects"`
+		}
+		if err := json.Unmarshal(data, &request); err != nil {
+			f.writeJSON(w, http.StatusBadRequest, map[string]string{"message": err.Error()})
+			return
+		}
+		store := f.lfsObjects
+		if strings.HasPrefix(r.URL.Path, "/source/") {
+			store = f.sourceLFSObjects
+		}
+		var objects []map[string]any
+		for _, object := range request.Objects {
+			result := map[string]any{"oid": object.Oid, "size": object.Size}
+			_, stored := store[object.Oid]
+			header := map[string]string{"X-Transfer-Token": "transfer-" + object.Oid}
+			switch {
+			case request.Operation == "upload" && !stored:
+				result["actions"] = map[string]any{
+					"upload": map[string]any{"href": f.server.URL + "/lfs/upload/" + object.Oid, "header": header},
+					"verify": map[string]any{"href": f.server.URL + "/lfs/verify/" + object.Oid, "header": header},
+				}
+			case request.Operation == "download" && stored:
+				result["actions"] = map[string]any{"download": map[string]any{"href": f.server.URL + "/lfs/download/" + object.Oid, "header": header}}
+			case request.Operation == "download":
+				result["error"] = map[string]any{"code": 404, "message": "Object does not exist"}
+			}
+			objects = append(objects, result)
+		}
+		f.writeJSON(w, http.StatusOK, map[string]any{"transfer": "basic", "objects": objects})
+	default:
+		action, oid, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/lfs/"), "/")
+		if r.Header.Get("X-Transfer-Token") != "transfer-"+oid {
+			f.writeJSON(w, http.StatusForbidden, map[string]string{"message": "Forbidden"})
+			return
+		}
+		switch action {
+		case "upload":
+			f.lfsObjects[oid] = data
+			w.WriteHeader(http.StatusOK)
+		case "verify":
+			if _, ok := f.lfsObjects[oid]; !ok {
+				f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Object does not exist"})
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case "download":
+			_, _ = w.Write(f.sourceLFSObjects[oid])
+		default:
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		}
+	}
+}
+
+// serveTree lists a tree by branch, commit or tree SHA, always recursively as the fake trees are flat
+func (f *fakeGitHub) serveTree(w http.ResponseWriter, ref string) {
+	sha := ref
+	if head, ok := f.refs[ref]; ok {
+		sha = head
+	}
+	if commit, ok := f.commits[sha]; ok {
+		sha = commit.Tree
+	}
+	tree, ok := f.trees[sha]
+	if !ok {
+		f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	entries := make([]map[string]string, 0, len(tree))
+	for path, entry := range tree {
+		entries = append(entries, map[string]string{"path": path, "mode": entry.Mode, "type": "blob", "sha": entry.Sha})
+	}
+	f.writeJSON(w, http.StatusOK, map[string]any{"sha": sha, "tree": entries, "truncated": false})
+}
+
+func (f *fakeGitHub) serveCreateTree(w http.ResponseWriter, body map[string]any) {
+	tree := make(map[string]fakeEntry)
+	if base, ok := body["base_tree"].(string); ok && base != "" {
+		tree = f.copyTree(base)
+	}
+	entries, _ := body["tree"].([]any)
+	for _, item := range entries {
+		entry := item.(map[string]any)
+		path := entry["path"].(string)
+		sha, hasSha := entry["sha"].(string)
+		if _, isNull := entry["sha"]; isNull && !hasSha {
+			delete(tree, path)
+			continue
+		}
+		if content, ok := entry["content"].(string); ok {
+			sha = f.storeBlob([]byte(content))
+		}
+		if _, ok := f.blobs[sha]; !ok {
+			f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "blob not found " + sha})
+			return
+		}
+		tree[path] = fakeEntry{Mode: entry["mode"].(string), Sha: sha}
+	}
+	f.writeJSON(w, http.StatusCreated, map[string]string{"sha": f.storeTree(tree)})
+}
+
+func (f *fakeGitHub) serveCommit(w http.ResponseWriter, r *http.Request, sha string, body map[string]any) {
+	switch r.Method {
+	case http.MethodGet:
+		commit, ok := f.commits[sha]
+		if !ok {
+			f.writeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+			return
+		}
+		f.writeJSON(w, http.StatusOK, map[string]any{"sha": sha, "message": commit.Message, "tree": map[string]string{"sha": commit.Tree}})
+	case http.MethodPost:
+		commit := fakeCommit{Tree: body["tree"].(string), Message: body["message"].(string)}
+		if _, ok := f.trees[commit.Tree]; !ok {
+			f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "tree not found"})
+			return
+		}
+		dates := make(map[string]int64)
+		for key, dest := range map[string]*string{"author": &commit.Author, "committer": &commit.Committer} {
+			if identity, ok := body[key].(map[string]any); ok {
+				*dest = fmt.Sprintf("%s <%s>", identity["name"], identity["email"])
+				if date, ok := identity["date"].(string); ok {
+					parsed, err := time.Parse(time.RFC3339, date)
+					if err != nil {
+						f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": err.Error()})
+						return
+					}
+					dates[key] = parsed.Unix()
+				}
+			}
+		}
+		parents, _ := body["parents"].([]any)
+		for _, parent := range parents {
+			commit.Parents = append(commit.Parents, parent.(string))
+		}
+		if signature, ok := body["signature"].(string); ok {
+			// Rebuild the commit object the way GitHub does to verify the signature
+			var payload strings.Builder
+			fmt.Fprintf(&payload, "tree %s\n", commit.Tree)
+			for _, parent := range commit.Parents {
+				fmt.Fprintf(&payload, "parent %s\n", parent)
+			}
+			fmt.Fprintf(&payload, "author %s %d +0000\ncommitter %s %d +0000\n\n%s",
+				commit.Author, dates["author"], commit.Committer, dates["committer"], commit.Message)
+			commit.Signature = signature
+			commit.Payload = payload.String()
+		}
+		f.writeJSON(w, http.StatusCreated, map[string]any{"sha": f.storeCommit(commit), "tree": map[string]string{"sha": commit.Tree}})
+	default:
+		f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (f *fakeGitHub) servePulls(w http.ResponseWriter, r *http.Request, body map[string]any) {
+	switch r.Method {
+	case http.MethodGet:
+		head := strings.TrimPrefix(r.URL.Query().Get("head"), fakeOwner+":")
+		base := r.URL.Query().Get("base")
+		result := []map[string]any{}
+		for _, pull := range f.pulls {
+			if pull.State == "open" && pull.Head == head && (base == "" || pull.Base == base) {
+				result = append(result, f.pullJSON(pull))
+			}
+		}
+		f.writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		pull := &fakePull{
+			Number: len(f.pulls) + 1,
+			Title:  body["title"].(string),
+			Body:   body["body"].(string),
+			Head:   body["head"].(string),
+			Base:   body["base"].(string),
+			State:  "open",
+		}
+		pull.Draft, _ = body["draft"].(bool)
+		if _, ok := f.refs[pull.Head]; !ok {
+			f.writeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "head not found"})
+			return
+		}
+		f.pulls = append(f.pulls, pull)
+		f.writeJSON(w, http.StatusCreated, f.pullJSON(pull))
+	default:
+		f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+// fakeIssueBase is the number of the first issue
+const fakeIssueBase = 1000
+
+// serveIssues lists the open issues, pull requests included as GitHub does, and creates issues
+func (f *fakeGitHub) serveIssues(w http.ResponseWriter, r *http.Request, body map[string]any) {
+	switch r.Method {
+	case http.MethodGet:
+		result := []map[string]any{}
+		if page := r.URL.Query().Get("page"); page != "" && page != "1" {
+			f.writeJSON(w, http.StatusOK, result)
+			return
+		}
+		for _, pull := range f.pulls {
+			if pull.State == "open" {
+				issue := f.pullJSON(pull)
+				issue["pull_request"] = map[string]any{"url": issue["html_url"]}
+				result = append(result, issue)
+			}
+		}
+		for number := fakeIssueBase; number < fakeIssueBase+len(f.issues); number++ {
+			if f.issues[number].State == "open" {
+				result = append(result, f.issueJSON(f.issues[number]))
+			}
+		}
+		f.writeJSON(w, http.StatusOK, result)
+	case http.MethodPost:
+		issue := &fakeIssue{
+			Number: fakeIssueBase + len(f.issues),
+			Title:  body["title"].(string),
+			Body:   body["body"].(string),
+			State:  "open",
+		}
+		f.issues[issue.Number] = issue
+		f.writeJSON(w, http.StatusCreated, f.issueJSON(issue))
+	default:
+		f.writeJSON(w, http.StatusMethodNotAllowed, nil)
+	}
+}
+
+func (f *fakeGitHub) issueJSON(issue *fakeIssue) map[string]any {
+	return map[string]any{
+		"number":   issue.Number,
+		"title":    issue.Title,
+		"body":     issue.Body,
+		"state":    issue.State,
+		"html_url": fmt.Sprintf("https://github.com/%s/%s/issues/%d", fakeOwner, fakeRepo, issue.Number),
+	}
+}
+
+func (f *fakeGitHub) pullJSON(pull *fakePull) map[string]any {
+	return map[string]any{
+		"number":   pull.Number,
+		"node_id":  fmt.Sprintf("PR_%d", pull.Number),
+		"title":    pull.Title,
+		"body":     pull.Body,
+		"state":    pull.State,
+		"draft":    pull.Draft,
+		"html_url": fmt.Sprintf("https://github.com/%s/%s/pull/%d", fakeOwner, fakeRepo, pull.Number),
+	}
+}
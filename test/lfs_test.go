@@ -0,0 +1,131 @@
+package cmd_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestParseLFSPointer tests recognizing Git LFS pointer files
+func TestParseLFSPointer(t *testing.T) {
+	pointer := gitcopy.NewLFSPointer([]byte("large content"))
+	if len(pointer.Oid) != 64 || pointer.Size != 13 {
+		t.Fatalf("unexpected pointer %+v", pointer)
+	}
+	parsed, ok := gitcopy.ParseLFSPointer(pointer.Bytes())
+	if !ok || parsed != pointer {
+		t.Errorf("Expected %+v to round trip, got %+v (%v)", pointer, parsed, ok)
+	}
+
+	for name, data := range map[string]string{
+		"plain text":   "hello\n",
+		"missing size": "version https://git-lfs.github.com/spec/v1\noid sha256:" + pointer.Oid + "\n",
+		"bad oid":      "version https://git-lfs.github.com/spec/v1\noid sha256:1234\nsize 13\n",
+		"too large":    string(pointer.Bytes()) + strings.Repeat("x", 1024),
+	} {
+		if _, ok := gitcopy.ParseLFSPointer([]byte(data)); ok {
+			t.Errorf("%s: Expected no pointer", name)
+		}
+	}
+}
+
+// TestLFSAttributes tests matching paths against the LFS patterns of a .gitattributes file
+func TestLFSAttributes(t *testing.T) {
+	attributes := gitcopy.ParseLFSAttributes([]byte(`# large files
+*.psd filter=lfs diff=lfs merge=lfs -text
+assets/** filter=lfs diff=lfs merge=lfs -text
+assets/icons/*.svg -filter
+*.md text eol=lf
+`))
+	tests := map[string]bool{
+		"design.psd":            true,
+		"art/nested/cover.psd":  true,
+		"assets/video.mp4":      true,
+		"assets/icons/logo.svg": false,
+		"src/assets/video.mp4":  false,
+		"README.md":             false,
+	}
+	for path, want := range tests {
+		if got := attributes.Tracked(path); got != want {
+			t.Errorf("Tracked(%q) = %v, expected %v", path, got, want)
+		}
+	}
+}
+
+// TestApplyLFS tests uploading Git LFS objects and committing their pointers
+func TestApplyLFS(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{".gitattributes": "*.bin filter=lfs diff=lfs merge=lfs -text\n"})
+	large := string(bytes.Repeat([]byte{0, 1, 2, 3}, 4096))
+	stored := []byte("object kept in the source LFS store")
+	storedPointer := gitcopy.NewLFSPointer(stored)
+	fake.sourceLFSObjects[storedPointer.Oid] = stored
+	source := writeSourceDir(t, map[string]string{
+		"model.bin":  large,
+		"sample.dat": string(storedPointer.Bytes()),
+		"README.md":  "readme\n",
+	})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.GitHub.Server = fake.server.URL
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "assets"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "assets/model.bin <- "+filepath.Join(source, "model.bin")+" (Git LFS)") {
+		t.Errorf("Expected model.bin to be marked as Git LFS in the plan:\n%s", out.String())
+	}
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	largePointer := gitcopy.NewLFSPointer([]byte(large))
+	if content, _ := fake.file("copy-branch", "assets/model.bin"); content != string(largePointer.Bytes()) {
+		t.Errorf("Expected the LFS pointer to be committed, got %q", content)
+	}
+	if content, _ := fake.file("copy-branch", "assets/sample.dat"); content != string(storedPointer.Bytes()) {
+		t.Errorf("Expected the source pointer to be committed, got %q", content)
+	}
+	if content, _ := fake.file("copy-branch", "assets/README.md"); content != "readme\n" {
+		t.Errorf("Expected README.md to be committed as is, got %q", content)
+	}
+	if string(fake.lfsObjects[largePointer.Oid]) != large {
+		t.Error("Expected model.bin to be uploaded to the LFS store")
+	}
+	if !bytes.Equal(fake.lfsObjects[storedPointer.Oid], stored) {
+		t.Error("Expected the source LFS object to be copied to the destination store")
+	}
+
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandStatus, &out); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "in sync: copy-branch") {
+		t.Errorf("Expected the copy branch to be in sync:\n%s", out.String())
+	}
+}
+
+// TestApplyLFSMissingObject tests that a pointer to an object nobody has fails before anything is committed
+func TestApplyLFSMissingObject(t *testing.T) {
+	fake := newFakeGitHub(t, nil)
+	missing := gitcopy.NewLFSPointer([]byte("lost"))
+	source := writeSourceDir(t, map[string]string{"lost.bin": string(missing.Bytes())})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.GitHub.Server = fake.server.URL
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "assets"
+	})
+
+	err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "is not available in source/repo") {
+		t.Errorf("Expected missing LFS object error, got %v", err)
+	}
+	if _, exists := fake.refs["copy-branch"]; exists {
+		t.Error("nothing must be committed when an LFS object cannot be uploaded")
+	}
+}
@@ -0,0 +1,139 @@
+package cmd_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestParseSize tests parsing the size limit inputs
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"":       0,
+		"1024":   1024,
+		"512KB":  512 << 10,
+		"10 mb":  10 << 20,
+		"1.5M":   3 << 19,
+		"2G":     2 << 30,
+		"100B":   100,
+		" 64k  ": 64 << 10,
+	}
+	for value, want := range tests {
+		got, err := gitcopy.ParseSize(value)
+		if err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v, expected %d", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"ten", "10TB", "-1MB", "0"} {
+		if _, err := gitcopy.ParseSize(value); err == nil {
+			t.Errorf("Expected ParseSize(%q) to fail", value)
+		}
+	}
+	if got := gitcopy.FormatSize(3 << 19); got != "1.5 MB" {
+		t.Errorf("FormatSize = %q, expected 1.5 MB", got)
+	}
+}
+
+// TestIsBinary tests telling binary files from text
+func TestIsBinary(t *testing.T) {
+	if gitcopy.IsBinary([]byte("plain text\nwith lines\n")) {
+		t.Error("Expected text not to be binary")
+	}
+	if !gitcopy.IsBinary([]byte{0x89, 'P', 'N', 'G', 0, 0, 0, 0x0d}) {
+		t.Error("Expected content with NUL bytes to be binary")
+	}
+	late := append(bytes.Repeat([]byte("a"), 9000), 0)
+	if gitcopy.IsBinary(late) {
+		t.Error("Expected only the start of the content to be inspected")
+	}
+}
+
+// TestApplyCopyLimits tests leaving out large and binary files with a reason for each
+func TestApplyCopyLimits(t *testing.T) {
+	fake := newFakeGitHub(t, nil)
+	source := writeSourceDir(t, map[string]string{
+		"a-small.txt": "small\n",
+		"b-large.txt": strings.Repeat("x", 3000),
+		"c-logo.png":  "\x89PNG\x00\x00\x00\x0d",
+		"d-notes.txt": strings.Repeat("n", 900),
+		"e-tail.txt":  strings.Repeat("t", 200),
+	})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "docs"
+		env.Input.MaxFileSize = "2KB"
+		env.Input.MaxTotalSize = "1KB"
+		env.Input.SkipBinary = "true"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	for _, want := range []string{
+		"skip      docs/b-large.txt <- " + filepath.Join(source, "b-large.txt") + " (excluded: 2.9 KB is larger than max_file_size 2.0 KB)",
+		"skip      docs/c-logo.png <- " + filepath.Join(source, "c-logo.png") + " (excluded: binary file, skip_binary is set)",
+		"skip      docs/e-tail.txt <- " + filepath.Join(source, "e-tail.txt") + " (excluded: copying its 200 B would exceed max_total_size 1.0 KB)",
+		"2 to create, 0 to update, 0 unchanged, 3 skipped",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "2 file(s) written") || !strings.Contains(out.String(), "excluded docs/c-logo.png: binary file, skip_binary is set\n") {
+		t.Errorf("Expected the written count and the excluded files in the apply output:\n%s", out.String())
+	}
+	if body := fake.pulls[0].Body; !strings.Contains(body, "Excluded files:\n- `docs/b-large.txt`: 2.9 KB is larger than max_file_size 2.0 KB\n- `docs/c-logo.png`: binary file, skip_binary is set\n") {
+		t.Errorf("Expected the excluded files in the pull request body:\n%s", body)
+	}
+	for path, want := range map[string]bool{"docs/a-small.txt": true, "docs/d-notes.txt": true, "docs/b-large.txt": false, "docs/c-logo.png": false, "docs/e-tail.txt": false} {
+		if _, ok := fake.file("copy-branch", path); ok != want {
+			t.Errorf("Expected %s to be written: %v", path, want)
+		}
+	}
+
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandStatus, &out); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	// The files already written no longer count towards max_total_size, so only e-tail.txt is left
+	if !strings.Contains(out.String(), "out of sync: 1 file(s) differ on copy-branch\n  docs/e-tail.txt\n") {
+		t.Errorf("Expected excluded files not to count as drift:\n%s", out.String())
+	}
+
+	env := gitcopy.GetEnvironment()
+	env.Input.MaxFileSize = "huge"
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandPlan, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "max_file_size") {
+		t.Errorf("Expected invalid max_file_size error, got %v", err)
+	}
+}
+
+// TestCheckModeExcludedFiles tests that files left out by the limits are not reported as drift
+func TestCheckModeExcludedFiles(t *testing.T) {
+	large := strings.Repeat("x", 3000)
+	fake := newFakeGitHub(t, map[string]string{"docs/large.txt": large, "docs/small.txt": "small\n"})
+	source := writeSourceDir(t, map[string]string{"large.txt": large, "small.txt": "small\n"})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Mode = "check"
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "docs"
+		env.Input.MaxFileSize = "2KB"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+		t.Fatalf("check failed: %v\n%s", err, out.String())
+	}
+	if !strings.Contains(out.String(), "in sync: master matches the source") {
+		t.Errorf("unexpected check output:\n%s", out.String())
+	}
+}
@@ -0,0 +1,111 @@
+package cmd_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestThreeWayMergeClean tests merging non-overlapping changes from both sides
+func TestThreeWayMergeClean(t *testing.T) {
+	base := "line1\nline2\nline3\nline4\nline5\n"
+	ours := "line1\nhotfix\nline3\nline4\nline5\n"
+	theirs := "line1\nline2\nline3\nline4\nline5 updated\nline6\n"
+
+	result := gitcopy.ThreeWayMerge([]byte(base), []byte(ours), []byte(theirs), "destination", "source")
+	if result.Conflicts != 0 {
+		t.Fatalf("Expected clean merge, got %d conflicts:\n%s", result.Conflicts, result.Content)
+	}
+
+	expected := "line1\nhotfix\nline3\nline4\nline5 updated\nline6\n"
+	if string(result.Content) != expected {
+		t.Errorf("Expected merged content:\n%s\ngot:\n%s", expected, result.Content)
+	}
+}
+
+// TestThreeWayMergeIdentical tests that identical changes on both sides do not conflict
+func TestThreeWayMergeIdentical(t *testing.T) {
+	base := "a\nb\nc\n"
+	changed := "a\nB\nc\n"
+
+	result := gitcopy.ThreeWayMerge([]byte(base), []byte(changed), []byte(changed), "destination", "source")
+	if result.Conflicts != 0 || string(result.Content) != changed {
+		t.Errorf("Expected %q without conflicts, got %q with %d conflicts", changed, result.Content, result.Conflicts)
+	}
+}
+
+// TestThreeWayMergeConflict tests that overlapping changes produce conflict markers
+func TestThreeWayMergeConflict(t *testing.T) {
+	base := "name: app\nversion: 1\n"
+	ours := "name: app\nversion: 1-hotfix\n"
+	theirs := "name: app\nversion: 2\n"
+
+	result := gitcopy.ThreeWayMerge([]byte(base), []byte(ours), []byte(theirs), "destination", "source")
+	if result.Conflicts != 1 {
+		t.Fatalf("Expected 1 conflict, got %d", result.Conflicts)
+	}
+
+	expected := "name: app\n<<<<<<< destination\nversion: 1-hotfix\n=======\nversion: 2\n>>>>>>> source\n"
+	if string(result.Content) != expected {
+		t.Errorf("Expected conflict output:\n%s\ngot:\n%s", expected, result.Content)
+	}
+}
+
+// TestThreeWayMergeMissingNewline tests conflicts on a final line without newline
+func TestThreeWayMergeMissingNewline(t *testing.T) {
+	result := gitcopy.ThreeWayMerge([]byte("a\nb"), []byte("a\nours"), []byte("a\ntheirs"), "destination", "source")
+	if result.Conflicts != 1 {
+		t.Fatalf("Expected 1 conflict, got %d", result.Conflicts)
+	}
+	if !strings.Contains(string(result.Content), "ours\n=======\ntheirs\n>>>>>>> source\n") {
+		t.Errorf("Conflict markers should start on their own line, got:\n%s", result.Content)
+	}
+
+	clean := gitcopy.ThreeWayMerge([]byte("a\nb"), []byte("a\nb"), []byte("a\nc"), "destination", "source")
+	if string(clean.Content) != "a\nc" {
+		t.Errorf("Clean merge should keep the missing final newline, got %q", clean.Content)
+	}
+}
+
+// TestParseMergeInputs tests merge and merge_conflicts input validation
+func TestParseMergeInputs(t *testing.T) {
+	for input, expected := range map[string]bool{"": false, "none": false, "three-way": true, "Three-Way": true} {
+		enabled, err := gitcopy.ParseMergeStrategy(input)
+		if err != nil {
+			t.Errorf("Unexpected error for merge %q: %v", input, err)
+		}
+		if enabled != expected {
+			t.Errorf("Expected merge %q to be %v, got %v", input, expected, enabled)
+		}
+	}
+	if _, err := gitcopy.ParseMergeStrategy("octopus"); err == nil {
+		t.Error("Expected error for unknown merge strategy, got nil")
+	}
+
+	mode, err := gitcopy.ParseMergeConflictMode("")
+	if err != nil || mode != gitcopy.MergeConflictMarkers {
+		t.Errorf("Expected default mode markers, got %s (%v)", mode, err)
+	}
+	mode, err = gitcopy.ParseMergeConflictMode("exclude")
+	if err != nil || mode != gitcopy.MergeConflictExclude {
+		t.Errorf("Expected mode exclude, got %s (%v)", mode, err)
+	}
+	if _, err := gitcopy.ParseMergeConflictMode("ours"); err == nil {
+		t.Error("Expected error for unknown merge_conflicts mode, got nil")
+	}
+}
+
+// TestFormatMerges tests the pull request section listing merged files
+func TestFormatMerges(t *testing.T) {
+	if lines := gitcopy.FormatMerges(nil, nil, nil); len(lines) != 0 {
+		t.Errorf("Expected no lines, got %v", lines)
+	}
+
+	body := strings.Join(gitcopy.FormatMerges([]string{"a.md"}, []string{"b.md"}, []string{"c.md"}), "\n")
+	for _, expected := range []string{"merged with the source", "- `a.md`", "conflict markers", "- `b.md`", "left out", "- `c.md`"} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("Expected %q in merge section, got:\n%s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cmd_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestNormalizer tests line ending, byte order mark and final newline normalization per pattern
+func TestNormalizer(t *testing.T) {
+	normalizer, err := gitcopy.ParseNormalizer("* eol=lf\n*.md strip-bom final-newline, *.bat eol=crlf final-newline\nvendor/ eol=keep")
+	if err != nil {
+		t.Fatalf("ParseNormalizer failed: %v", err)
+	}
+	tests := []struct {
+		path    string
+		content string
+		want    string
+	}{
+		{path: "docs/guide.md", content: "\ufeff# Guide\r\n\r\ntext", want: "# Guide\n\ntext\n"},
+		{path: "scripts/run.sh", content: "#!/bin/sh\r\necho hi\r\n", want: "#!/bin/sh\necho hi\n"},
+		{path: "scripts/run.sh", content: "\ufeffno newline", want: "\ufeffno newline"},
+		{path: "build.bat", content: "@echo off\nmixed\r\nend", want: "@echo off\r\nmixed\r\nend\r\n"},
+		{path: "vendor/lib.c", content: "int x;\r\n", want: "int x;\r\n"},
+		{path: "image.png", content: "\x89PNG\r\n\x00\r\n", want: "\x89PNG\r\n\x00\r\n"},
+		{path: "empty.md", content: "", want: ""},
+	}
+	for _, tt := range tests {
+		if got := string(normalizer.Normalize(tt.path, []byte(tt.content))); got != tt.want {
+			t.Errorf("Normalize(%q, %q) = %q, expected %q", tt.path, tt.content, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"*.md", "*.md eol=cr", "*.md trim"} {
+		if _, err := gitcopy.ParseNormalizer(value); err == nil || !strings.Contains(err.Error(), "invalid normalize rule") {
+			t.Errorf("Expected invalid normalize rule error for %q, got %v", value, err)
+		}
+	}
+}
+
+// TestApplyNormalize tests that files differing only in line endings or byte order marks are unchanged
+func TestApplyNormalize(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{
+		"docs/README.md":  "# Readme\n\nSame content\n",
+		"docs/CHANGES.md": "# Changes\n",
+	})
+	source := writeSourceDir(t, map[string]string{
+		"README.md":  "\ufeff# Readme\r\n\r\nSame content\r\n",
+		"CHANGES.md": "# Changes\r\n- fixed\r\n",
+	})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "docs"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "0 to create, 2 to update, 0 unchanged") {
+		t.Errorf("Expected both files to differ without normalization:\n%s", out.String())
+	}
+
+	env := gitcopy.GetEnvironment()
+	env.Input.Normalize = "*.md eol=lf strip-bom final-newline"
+	gitcopy.SetEnvironment(env)
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "0 to create, 1 to update, 1 unchanged") {
+		t.Errorf("Expected only the real change to count:\n%s", out.String())
+	}
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if content, _ := fake.file("copy-branch", "docs/CHANGES.md"); content != "# Changes\n- fixed\n" {
+		t.Errorf("Expected the normalized content to be written, got %q", content)
+	}
+}
@@ -0,0 +1,138 @@
+package cmd_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestPathRenamer tests glob and regex rename rules and flattening
+func TestPathRenamer(t *testing.T) {
+	tests := []struct {
+		name    string
+		rename  string
+		flatten bool
+		paths   map[string]string
+	}{
+		{
+			name:   "basename glob",
+			rename: "*.tmpl -> *",
+			paths: map[string]string{
+				"Makefile.tmpl":        "Makefile",
+				"deploy/values.tmpl":   "deploy/values",
+				"deploy/values.yaml":   "deploy/values.yaml",
+				"deploy/tmpl/notes.md": "deploy/tmpl/notes.md",
+			},
+		},
+		{
+			name:   "directory glob",
+			rename: "env/dev/* -> config/*\nenv/**/secrets.yaml -> private/**.yaml",
+			paths: map[string]string{
+				"env/dev/app.yaml":          "config/app.yaml",
+				"env/dev/nested/app.yaml":   "env/dev/nested/app.yaml",
+				"env/prod/eu/secrets.yaml":  "private/prod/eu.yaml",
+				"env/prod/app.yaml":         "env/prod/app.yaml",
+				"other/env/dev/config.yaml": "other/env/dev/config.yaml",
+			},
+		},
+		{
+			name:   "first rule wins",
+			rename: "*.md -> docs-*.md, README.md -> index.md",
+			paths:  map[string]string{"README.md": "docs-README.md"},
+		},
+		{
+			name:   "regex",
+			rename: `regex:^env/(\w+)/(.+)\.yml$ -> $1/$2.yaml`,
+			paths: map[string]string{
+				"env/dev/app.yml":  "dev/app.yaml",
+				"env/dev/app.yaml": "env/dev/app.yaml",
+			},
+		},
+		{
+			name:   "regex takes the rest of the line",
+			rename: "*.tmpl -> *, regex:^a{1,2}/(.*) -> b/$1\nregex:^(x|y),(.*) -> $2",
+			paths: map[string]string{
+				"aa/notes.md":   "b/notes.md",
+				"aaa/notes.md":  "aaa/notes.md",
+				"a/run.sh.tmpl": "a/run.sh",
+				"x,file.txt":    "file.txt",
+			},
+		},
+		{
+			name:    "flatten after rename",
+			rename:  "*.tmpl -> *",
+			flatten: true,
+			paths: map[string]string{
+				"a/b/run.sh.tmpl": "run.sh",
+				"top.txt":         "top.txt",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			renamer, err := gitcopy.NewPathRenamer(tt.rename, tt.flatten)
+			if err != nil {
+				t.Fatalf("NewPathRenamer failed: %v", err)
+			}
+			for path, want := range tt.paths {
+				if got := renamer.Rename(path); got != want {
+					t.Errorf("Rename(%q) = %q, expected %q", path, got, want)
+				}
+			}
+		})
+	}
+
+	for _, rename := range []string{"*.tmpl", "-> config", "*.tmpl -> */*/*", "regex:( -> x"} {
+		if _, err := gitcopy.NewPathRenamer(rename, false); err == nil || !strings.Contains(err.Error(), "invalid rename rule") {
+			t.Errorf("Expected invalid rename rule error for %q, got %v", rename, err)
+		}
+	}
+}
+
+// TestApplyRenameRules tests renaming the files of a directory copy and rejecting clashing destinations
+func TestApplyRenameRules(t *testing.T) {
+	fake := newFakeGitHub(t, nil)
+	source := writeSourceDir(t, map[string]string{
+		"Dockerfile.tmpl":   "FROM scratch\n",
+		"env/dev/app.yaml":  "debug: true\n",
+		"env/prod/app.yaml": "debug: false\n",
+	})
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "service"
+		env.Input.Rename = "*.tmpl -> *\nenv/dev/* -> config/*"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "service/config/app.yaml <- ") {
+		t.Errorf("Expected the renamed path in the plan:\n%s", out.String())
+	}
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	want := map[string]string{
+		"service/Dockerfile":        "FROM scratch\n",
+		"service/config/app.yaml":   "debug: true\n",
+		"service/env/prod/app.yaml": "debug: false\n",
+	}
+	for path, content := range want {
+		if got, _ := fake.file("copy-branch", path); got != content {
+			t.Errorf("Expected %s to be %q, got %q", path, content, got)
+		}
+	}
+
+	env := gitcopy.GetEnvironment()
+	env.Input.Rename = ""
+	env.Input.Flatten = "true"
+	gitcopy.SetEnvironment(env)
+	err := gitcopy.Run(gitcopy.CommandPlan, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "are both copied to service/app.yaml") {
+		t.Errorf("Expected clashing destination error, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// Test credentials are assembled at run time so the repository itself holds no secret-looking strings
+var (
+	testGitHubToken = "ghp_" + strings.Repeat("a1B2c3D4e5", 4)
+	testAWSKeyId    = "AKIA" + "ABCDEFGH23456789"
+	testPrivateKey  = "-----BEGIN " + "RSA PRIVATE KEY-----"
+	testRandomKey   = "q8Zr3LmX0vT7nWc2Yk5JbP1sHd9Gf4Ae6Uo"
+)
+
+// TestSecretScanner tests the built-in rules, custom patterns and the allowlist
+func TestSecretScanner(t *testing.T) {
+	scanner, err := gitcopy.NewSecretScanner(`internal-[0-9]{6}`, nil)
+	if err != nil {
+		t.Fatalf("NewSecretScanner failed: %v", err)
+	}
+	content := strings.Join([]string{
+		"# configuration",
+		"token: " + testGitHubToken,
+		"aws_access_key_id = " + testAWSKeyId,
+		testPrivateKey,
+		`api_key = "` + testRandomKey + `"`,
+		"ticket: internal-123456",
+		"commit: 3f786850e387550fdab836ed7e6dc881de23001b",
+		"image: ghcr.io/pal-paul/git-copy:v1.2.3",
+	}, "\n")
+	findings := scanner.Scan("config/app.yaml", []byte(content))
+	want := []string{
+		"config/app.yaml:2: github-token",
+		"config/app.yaml:3: aws-access-key-id",
+		"config/app.yaml:4: private-key",
+		"config/app.yaml:5: high-entropy-string",
+		"config/app.yaml:6: custom-pattern-1",
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("Expected %d findings, got %v", len(want), findings)
+	}
+	for i, finding := range findings {
+		if finding.String() != want[i] {
+			t.Errorf("Expected finding %q, got %q", want[i], finding)
+		}
+		if strings.Contains(finding.String(), testGitHubToken) {
+			t.Error("findings must not include the secret")
+		}
+	}
+
+	if findings := scanner.Scan("image.png", append([]byte(testGitHubToken), 0)); len(findings) != 0 {
+		t.Errorf("Expected binary files to be skipped, got %v", findings)
+	}
+
+	allowlist := "# reviewed\nfixtures/\nconfig/app.yaml:3\nmatch:^" + testRandomKey + "$\n"
+	scanner, err = gitcopy.NewSecretScanner("", []byte(allowlist))
+	if err != nil {
+		t.Fatalf("NewSecretScanner failed: %v", err)
+	}
+	if findings := scanner.Scan("fixtures/keys.pem", []byte(testPrivateKey)); len(findings) != 0 {
+		t.Errorf("Expected allowlisted files to be skipped, got %v", findings)
+	}
+	findings = scanner.Scan("config/app.yaml", []byte(content))
+	if len(findings) != 2 || findings[0].Line != 2 || findings[1].Line != 4 {
+		t.Errorf("Expected the allowlisted line and match to be ignored, got %v", findings)
+	}
+
+	if _, err := gitcopy.NewSecretScanner("(", nil); err == nil {
+		t.Error("Expected an invalid pattern to fail")
+	}
+	if _, err := gitcopy.ParseSecretScanMode("strict"); err == nil {
+		t.Error("Expected an invalid secret_scan to fail")
+	}
+}
+
+// TestSecretScannerEntropyBoundary tests the shortest tokens the entropy check can report
+func TestSecretScannerEntropyBoundary(t *testing.T) {
+	scanner, err := gitcopy.NewSecretScanner("", nil)
+	if err != nil {
+		t.Fatalf("NewSecretScanner failed: %v", err)
+	}
+	// Every character differs, so the entropy is log2 of the length: 4.58 for 24, 4.52 for 23, 4.46 for 22
+	distinct := "aB3dE5gH7jK9mN1pQ2rS4tU6"
+	for _, length := range []int{24, 23} {
+		if findings := scanner.Scan("keys.txt", []byte("key="+distinct[:length])); len(findings) != 1 || findings[0].Rule != "high-entropy-string" {
+			t.Errorf("Expected a %d character random token to be reported, got %v", length, findings)
+		}
+	}
+	if findings := scanner.Scan("keys.txt", []byte("key="+distinct[:22])); len(findings) != 0 {
+		t.Errorf("Expected tokens shorter than 23 characters to be ignored, got %v", findings)
+	}
+}
+
+// TestApplySecretScan tests that secrets block the push in block mode and are only reported in warn mode
+func TestApplySecretScan(t *testing.T) {
+	fake := newFakeGitHub(t, nil)
+	source := writeSourceDir(t, map[string]string{
+		"README.md":   "readme\n",
+		"deploy.env":  "REGION=eu\nGITHUB_TOKEN=" + testGitHubToken + "\n",
+		"example.env": "GITHUB_TOKEN=" + testGitHubToken + "\n",
+	})
+	allowlist := filepath.Join(t.TempDir(), "secrets-allowlist")
+	if err := os.WriteFile(allowlist, []byte("example.env\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "config"
+		env.Input.SecretScan = "block"
+		env.Input.SecretAllowlist = allowlist
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "Possible secrets found, nothing is pushed:\n  config/deploy.env:2: github-token\n") {
+		t.Errorf("Expected the finding in the plan output:\n%s", out.String())
+	}
+	if strings.Contains(out.String(), "config/example.env:") {
+		t.Errorf("Expected the allowlisted file to be left out:\n%s", out.String())
+	}
+
+	err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "1 possible secret(s) found in the files to copy: config/deploy.env:2: github-token") {
+		t.Errorf("Expected the secret to block the push, got %v", err)
+	}
+	if _, exists := fake.refs["copy-branch"]; exists {
+		t.Error("nothing must be pushed when a secret blocks the run")
+	}
+
+	env := gitcopy.GetEnvironment()
+	env.Input.SecretScan = "warn"
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if _, ok := fake.file("copy-branch", "config/deploy.env"); !ok {
+		t.Error("Expected the files to be pushed in warn mode")
+	}
+}
@@ -0,0 +1,301 @@
+package cmd_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/pal-paul/git-copy/internal/gitcopy"
+)
+
+// TestReadSourceDirModes tests that the executable bit of source files is recorded
+func TestReadSourceDirModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no executable bit")
+	}
+	source := writeSourceDir(t, map[string]string{"README.md": "readme\n", "scripts/run.sh": "#!/bin/sh\n"})
+	if err := os.Chmod(filepath.Join(source, "scripts", "run.sh"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := gitcopy.ReadSourceDir(source, gitcopy.SymlinkFollow)
+	if err != nil {
+		t.Fatalf("ReadSourceDir failed: %v", err)
+	}
+	modes := make(map[string]string)
+	for _, file := range files {
+		relativePath, _ := filepath.Rel(source, file.Path)
+		modes[filepath.ToSlash(relativePath)] = file.Mode
+	}
+	want := map[string]string{"README.md": "100644", "scripts/run.sh": "100755"}
+	for path, mode := range want {
+		if modes[path] != mode {
+			t.Errorf("Expected mode %s for %s, got %q", mode, path, modes[path])
+		}
+	}
+}
+
+// TestApplyFileModes tests that executables are committed as such and that a mode change alone is a diff
+func TestApplyFileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows has no executable bit")
+	}
+	fake := newFakeGitHub(t, map[string]string{"scripts/lint.sh": "#!/bin/sh\nlint\n"})
+	source := writeSourceDir(t, map[string]string{"run.sh": "#!/bin/sh\nrun\n", "lint.sh": "#!/bin/sh\nlint\n", "notes.md": "notes\n"})
+	for _, name := range []string{"run.sh", "lint.sh"} {
+		if err := os.Chmod(filepath.Join(source, name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "scripts"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "scripts/lint.sh <- "+filepath.Join(source, "lint.sh")+" (mode 100644 -> 100755)") {
+		t.Errorf("Expected the mode change in the plan:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandDiff, &out); err != nil {
+		t.Fatalf("diff failed: %v", err)
+	}
+	for _, want := range []string{"old mode 100644\nnew mode 100755\n", "new file mode 100755\n--- /dev/null\n+++ b/scripts/run.sh"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("diff output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	want := map[string]string{"scripts/run.sh": "100755", "scripts/lint.sh": "100755", "scripts/notes.md": "100644"}
+	for path, mode := range want {
+		if got := fake.mode("copy-branch", path); got != mode {
+			t.Errorf("Expected %s to be committed with mode %s, got %q", path, mode, got)
+		}
+	}
+
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandStatus, &out); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "in sync: copy-branch") {
+		t.Errorf("Expected the copy branch to be in sync:\n%s", out.String())
+	}
+
+	// A second run neither rewrites the link nor mistakes it for a destination edit
+	out.Reset()
+	if err := gitcopy.Run(gitcopy.CommandApply, &out); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if count := fake.commitCount("copy-branch"); count != 1 || strings.Contains(out.String(), "modified") {
+		t.Errorf("Expected nothing to be written, got %d commit(s):\n%s", count, out.String())
+	}
+}
+
+// TestReadSourceDirSymlinks tests following, preserving and skipping symbolic links, including a link cycle
+func TestReadSourceDirSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping symlink test on Windows")
+	}
+	source := writeSourceDir(t, map[string]string{"README.md": "readme\n", "shared/common.md": "common\n"})
+	for link, target := range map[string]string{"latest.md": "README.md", "docs": "shared", "shared/loop": ".."} {
+		if err := os.Symlink(target, filepath.Join(source, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		policy gitcopy.SymlinkPolicy
+		want   map[string]string
+	}{
+		{
+			policy: gitcopy.SymlinkFollow,
+			// shared/loop and docs/loop lead back to the source directory and are skipped
+			want: map[string]string{
+				"README.md": "100644", "latest.md": "100644", "shared/common.md": "100644", "docs/common.md": "100644",
+			},
+		},
+		{
+			policy: gitcopy.SymlinkPreserve,
+			want: map[string]string{
+				"README.md": "100644", "latest.md": "120000", "shared/common.md": "100644", "docs": "120000", "shared/loop": "120000",
+			},
+		},
+		{
+			policy: gitcopy.SymlinkSkip,
+			want:   map[string]string{"README.md": "100644", "shared/common.md": "100644"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			files, err := gitcopy.ReadSourceDir(source, tt.policy)
+			if err != nil {
+				t.Fatalf("ReadSourceDir failed: %v", err)
+			}
+			got := make(map[string]string)
+			for _, file := range files {
+				relativePath, _ := filepath.Rel(source, file.Path)
+				got[filepath.ToSlash(relativePath)] = file.Mode
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("Expected files %v, got %v", tt.want, got)
+			}
+			for path, mode := range tt.want {
+				if got[path] != mode {
+					t.Errorf("Expected %s with mode %s, got %q", path, mode, got[path])
+				}
+			}
+		})
+	}
+
+	if _, err := gitcopy.ParseSymlinkPolicy("preserve"); err == nil {
+		t.Error("Expected error for unknown symlinks policy")
+	}
+}
+
+// TestApplyPreservedSymlinks tests committing symbolic links as links
+func TestApplyPreservedSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Skipping symlink test on Windows")
+	}
+	fake := newFakeGitHub(t, nil)
+	source := writeSourceDir(t, map[string]string{"README.md": "readme\n"})
+	if err := os.Symlink("README.md", filepath.Join(source, "index.md")); err != nil {
+		t.Fatal(err)
+	}
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.Directory = source
+		env.Input.DestinationDirectory = "docs"
+		env.Input.Symlinks = "preserve-as-link"
+		env.Input.LockFile = ".git-copy.lock"
+	})
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if content, _ := fake.file("copy-branch", "docs/index.md"); content != "README.md" {
+		t.Errorf("Expected the link target as content, got %q", content)
+	}
+	if mode := fake.mode("copy-branch", "docs/index.md"); mode != "120000" {
+		t.Errorf("Expected the link to be committed with mode 120000, got %q", mode)
+	}
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandStatus, &out); err != nil {
+		t.Fatalf("status failed: %v", err)
+	}
+	if !strings.Contains(out.String(), "in sync: copy-branch") {
+		t.Errorf("Expected the copy branch to be in sync:\n%s", out.String())
+	}
+}
+
+// TestApplyRemoteSource tests copying from a branch of a repository read through the API
+func TestApplyRemoteSource(t *testing.T) {
+	fake := newFakeGitHub(t, map[string]string{"README.md": "destination\n"})
+	fake.refs["templates"] = fake.refs["master"]
+	fake.commitFile("templates", "ci/build.yml", "build: true\n")
+	fake.commitFileMode("templates", "ci/scripts/lint.sh", "#!/bin/sh\n", "100755")
+	fake.commitFileMode("templates", "ci/latest.yml", "build.yml", "120000")
+	fake.commitFile("templates", "docs/CONTRIBUTING.md", "contributing\n")
+	templates := fake.refs["templates"]
+	fake.useEnvironment(t, func(env *gitcopy.Environment) {
+		env.Input.SourceOwner = "test-owner"
+		env.Input.SourceRepo = "test-repo"
+		env.Input.SourceRef = "templates"
+		env.Input.FilePath = "docs/CONTRIBUTING.md"
+		env.Input.DestinationFilePath = "CONTRIBUTING.md"
+		env.Input.Directory = "ci/"
+		env.Input.DestinationDirectory = ".github/ci"
+	})
+
+	var out bytes.Buffer
+	if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	for _, want := range []string{"source test-owner/test-repo@templates (", "create    .github/ci/scripts/lint.sh <- ci/scripts/lint.sh"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan output missing %q:\n%s", want, out.String())
+		}
+	}
+
+	if err := gitcopy.Run(gitcopy.CommandApply, &bytes.Buffer{}); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	want := map[string]string{
+		"CONTRIBUTING.md":            "contributing\n",
+		".github/ci/build.yml":       "build: true\n",
+		".github/ci/latest.yml":      "build: true\n",
+		".github/ci/scripts/lint.sh": "#!/bin/sh\n",
+	}
+	for path, content := range want {
+		if got, _ := fake.file("copy-branch", path); got != content {
+			t.Errorf("Expected %s to be %q, got %q", path, content, got)
+		}
+	}
+	if mode := fake.mode("copy-branch", ".github/ci/scripts/lint.sh"); mode != "100755" {
+		t.Errorf("Expected lint.sh to keep mode 100755, got %q", mode)
+	}
+	if message := fake.head("copy-branch").Message; !strings.Contains(message, "Source-Repo: test-owner/test-repo\nSource-Commit: "+templates) {
+		t.Errorf("Expected the trailers to name the remote source, got %q", message)
+	}
+
+	// Directories rooted at the repository name the same tree paths
+	env := gitcopy.GetEnvironment()
+	for directory, want := range map[string]string{"/ci": ".github/ci/scripts/lint.sh <- ci/scripts/lint.sh", "/": ".github/ci/ci/scripts/lint.sh <- ci/scripts/lint.sh"} {
+		env.Input.Directory = directory
+		gitcopy.SetEnvironment(env)
+		out.Reset()
+		if err := gitcopy.Run(gitcopy.CommandPlan, &out); err != nil {
+			t.Fatalf("plan of %s failed: %v", directory, err)
+		}
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("plan of %s missing %q:\n%s", directory, want, out.String())
+		}
+	}
+
+	env.Input.SourceRef = "missing"
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandPlan, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "failed to resolve source ref missing") {
+		t.Errorf("Expected unknown source ref error, got %v", err)
+	}
+	env.Input.SourceRepo = ""
+	gitcopy.SetEnvironment(env)
+	if err := gitcopy.Run(gitcopy.CommandPlan, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "source_owner and source_repo must be set together") {
+		t.Errorf("Expected incomplete source error, got %v", err)
+	}
+}
+
+// TestSourceRepoPath tests the repository path recorded in the lockfile for each kind of source
+func TestSourceRepoPath(t *testing.T) {
+	checkout := writeSourceDir(t, map[string]string{".git/HEAD": "ref: refs/heads/main\n", "config/app.yaml": "a: 1\n"})
+	local := gitcopy.SourceRevision{Repo: "org/source"}
+	if got := local.RepoPath(filepath.Join(checkout, "config", "app.yaml")); got != "config/app.yaml" {
+		t.Errorf("Expected the path relative to the checkout, got %q", got)
+	}
+	t.Chdir(checkout)
+	if got := local.RepoPath("./config/app.yaml"); got != "config/app.yaml" {
+		t.Errorf("Expected a relative path to resolve against the checkout, got %q", got)
+	}
+	outside := writeSourceDir(t, map[string]string{"app.yaml": "a: 1\n"})
+	if got := local.RepoPath(filepath.Join(outside, "app.yaml")); got != "" {
+		t.Errorf("Expected no path outside a git work tree, got %q", got)
+	}
+
+	remote := gitcopy.SourceRevision{Repo: "org/source", Remote: true}
+	if got := remote.RepoPath("/config/app.yaml"); got != "config/app.yaml" {
+		t.Errorf("Expected the remote path as it is, got %q", got)
+	}
+	archive := gitcopy.SourceRevision{Repo: "org/source", Archive: "release.tar.gz"}
+	if got := archive.RepoPath("config/app.yaml"); got != "" {
+		t.Errorf("Expected no repository path for archives, got %q", got)
+	}
+}